@@ -0,0 +1,208 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// sampleLinesField is the string field of the alert frame with the recent matching log lines.
+	// It isn't a label, since labels identify the alert instance and the lines change on every evaluation.
+	sampleLinesField = "sample_lines"
+	// maxSampledSeries limits the number of alert series the sample lines are fetched for
+	maxSampledSeries = 50
+	// sampleLinesConcurrency limits the number of concurrent sample lines queries
+	sampleLinesConcurrency = 5
+	// sampleLinesTimeout limits the time spent on fetching sample lines during the alert evaluation
+	sampleLinesTimeout = 5 * time.Second
+	// maxSampleLines limits the number of sample lines per alert series
+	maxSampleLines = 10
+	// maxSampleLineLen limits the length of a single sample line
+	maxSampleLineLen = 512
+)
+
+// statsPipe matches the beginning of the stats pipe in the query expression
+var statsPipe = regexp.MustCompile(`(?i)\|\s*stats[\s(]`)
+
+// attachSampleLines fetches the most recent log lines matching every alert series
+// and adds them to the series frame as the sampleLinesField string field, so they can be used in notification templates.
+// Series labels aren't changed, so alert instances stay the same between evaluations.
+// Errors are logged and don't fail the alert query.
+func (di *DatasourceInstance) attachSampleLines(ctx context.Context, q *Query, frames data.Frames) {
+	filter := sampleLinesFilter(q.Expr)
+	if filter == "" {
+		return
+	}
+	byFields := sampleLinesByFields(q.Expr)
+	limit := q.AlertSampleLines
+	if limit > maxSampleLines {
+		limit = maxSampleLines
+	}
+	if len(frames) > maxSampledSeries {
+		backend.Logger.Warn("skipping sample lines for alert series", "refId", q.RefID, "series", len(frames)-maxSampledSeries)
+		frames = frames[:maxSampledSeries]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sampleLinesTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, sampleLinesConcurrency)
+	for _, frame := range frames {
+		valueFd := alertValueField(frame)
+		if valueFd == nil {
+			continue
+		}
+
+		sq := &Query{
+			DataQuery:          q.DataQuery,
+			Expr:               sampleLinesExpr(filter, byFields, valueFd.Labels),
+			MaxLines:           limit,
+			QueryType:          QueryTypeInstant,
+			ExtraFilters:       q.ExtraFilters,
+			ExtraStreamFilters: q.ExtraStreamFilters,
+		}
+		wg.Add(1)
+		go func(frame *data.Frame, labels data.Labels) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				backend.Logger.Warn("failed to fetch sample lines for alert series", "refId", q.RefID, "labels", labels.String(), "error", ctx.Err())
+				return
+			}
+			defer func() { <-sem }()
+
+			lines, err := di.sampleLines(ctx, sq)
+			if err != nil {
+				backend.Logger.Warn("failed to fetch sample lines for alert series", "refId", q.RefID, "labels", labels.String(), "error", err)
+				return
+			}
+			if len(lines) == 0 {
+				return
+			}
+			addSampleLinesField(frame, strings.Join(lines, "\n"))
+		}(frame, valueFd.Labels)
+	}
+	wg.Wait()
+}
+
+// addSampleLinesField adds the sample lines to the last row of the frame, i.e. to the most recent value
+func addSampleLinesField(frame *data.Frame, lines string) {
+	values := make([]*string, frame.Rows())
+	if len(values) == 0 {
+		return
+	}
+	values[len(values)-1] = &lines
+	frame.Fields = append(frame.Fields, data.NewField(sampleLinesField, nil, values))
+}
+
+// sampleLines returns log lines of the instant query
+func (di *DatasourceInstance) sampleLines(ctx context.Context, q *Query) ([]string, error) {
+	r, err := di.datasourceQuery(ctx, q, false)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, nil
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			backend.Logger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	resp := parseInstantResponse(r)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	var lines []string
+	for _, frame := range resp.Frames {
+		lineFd, _ := frame.FieldByName(gLineField)
+		if lineFd == nil {
+			continue
+		}
+		for i := 0; i < lineFd.Len(); i++ {
+			line, ok := lineFd.At(i).(string)
+			if !ok {
+				continue
+			}
+			if utf8.RuneCountInString(line) > maxSampleLineLen {
+				line = string([]rune(line)[:maxSampleLineLen]) + "…"
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// alertValueField returns the numeric field of the alert frame
+func alertValueField(frame *data.Frame) *data.Field {
+	for _, fd := range frame.Fields {
+		if fd.Type().Numeric() {
+			return fd
+		}
+	}
+	return nil
+}
+
+// sampleLinesFilter returns the part of the stats query expression before the stats pipe
+func sampleLinesFilter(expr string) string {
+	loc := statsPipe.FindStringIndex(expr)
+	if loc == nil {
+		return ""
+	}
+	return strings.TrimSpace(expr[:loc[0]])
+}
+
+// sampleLinesByFields returns the fields listed in the `by (...)` clause of the first stats pipe.
+// Bucketed fields, e.g. `_time:1h` or `status:10`, are skipped since their label values don't match the logs.
+func sampleLinesByFields(expr string) []string {
+	m := statsByClause.FindStringSubmatch(expr)
+	if m == nil {
+		return nil
+	}
+	var fields []string
+	for _, part := range strings.Split(m[1], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if isQuoted(part) {
+			fields = append(fields, unquoteLegendToken(part))
+			continue
+		}
+		if strings.ContainsAny(part, ": \t") || part == "_time" {
+			continue
+		}
+		fields = append(fields, part)
+	}
+	return fields
+}
+
+// sampleLinesExpr returns the query expression which selects logs of the series
+// with the given values of the `by (...)` fields
+func sampleLinesExpr(filter string, byFields []string, labels data.Labels) string {
+	var filters []string
+	for _, name := range byFields {
+		value, ok := labels[name]
+		if !ok {
+			continue
+		}
+		filters = append(filters, fmt.Sprintf("%s:=%s", strconv.Quote(name), strconv.Quote(value)))
+	}
+	if len(filters) == 0 {
+		return filter
+	}
+	return fmt.Sprintf("%s | filter %s", filter, strings.Join(filters, " "))
+}
@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func Test_sampleLinesExpr(t *testing.T) {
+	type opts struct {
+		expr   string
+		labels data.Labels
+		want   string
+	}
+	f := func(opts opts) {
+		t.Helper()
+		got := sampleLinesExpr(sampleLinesFilter(opts.expr), sampleLinesByFields(opts.expr), opts.labels)
+		if got != opts.want {
+			t.Fatalf("sampleLinesExpr() = %q, want %q", got, opts.want)
+		}
+	}
+
+	// no stats pipe
+	o := opts{
+		expr: "error",
+		want: "",
+	}
+	f(o)
+
+	// stats without labels
+	o = opts{
+		expr:   "error | stats count()",
+		labels: data.Labels{"__name__": "count(*)"},
+		want:   "error",
+	}
+	f(o)
+
+	// stats by labels
+	o = opts{
+		expr:   `_time:5m error | extract "user=<user> " | stats by (service, user) count() hits | filter hits:>10`,
+		labels: data.Labels{"__name__": "hits", "user": `"bob"`, "service": "api"},
+		want:   `_time:5m error | extract "user=<user> " | filter "service":="api" "user":="\"bob\""`,
+	}
+	f(o)
+
+	// time buckets and bucketed fields aren't used as filters
+	o = opts{
+		expr:   `error | stats by (_time:5m, status:10, "service") count()`,
+		labels: data.Labels{"__name__": "count(*)", "_time": "2024-01-01T00:00:00Z", "status": "500", "service": "api"},
+		want:   `error | filter "service":="api"`,
+	}
+	f(o)
+
+	// labels of the pipes after stats aren't used as filters
+	o = opts{
+		expr:   `error | stats by (service) count() hits | math hits*2 as double`,
+		labels: data.Labels{"__name__": "hits", "service": "api", "double": "4"},
+		want:   `error | filter "service":="api"`,
+	}
+	f(o)
+}
+
+func TestDatasourceAlertSampleLines(t *testing.T) {
+	var mu sync.Mutex
+	var sampleQueries []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/stats_query", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"count(*)","service":"api"},"value":[1704067200,"2"]},{"metric":{"__name__":"count(*)","service":"web"},"value":[1704067200,"1"]}]}}`))
+	})
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+			return
+		}
+		if r.Form.Get("limit") != "2" {
+			t.Errorf("unexpected limit %q", r.Form.Get("limit"))
+		}
+		query := r.Form.Get("query")
+		mu.Lock()
+		sampleQueries = append(sampleQueries, query)
+		mu.Unlock()
+		if query == `_time:[1704067140, 1704067200] error | filter "service":="api"` {
+			_, _ = w.Write([]byte(`{"_msg":"first error","_time":"2024-01-01T00:00:00Z"}` + "\n" + `{"_msg":"second error","_time":"2024-01-01T00:00:01Z"}`))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	d := NewDatasource()
+	rsp, err := d.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      srv.URL,
+				JSONData: []byte(`{"httpMethod":"POST"}`),
+			},
+		},
+		Headers: map[string]string{requestFromAlert: "true"},
+		Queries: []backend.DataQuery{
+			{
+				RefID: "A",
+				TimeRange: backend.TimeRange{
+					From: time.Unix(1704067140, 0),
+					To:   time.Unix(1704067200, 0),
+				},
+				JSON: []byte(`{"refId":"A","queryType":"stats","expr":"error | stats by (service) count()","alertSampleLines":2}`),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp := rsp.Responses["A"]
+	if resp.Error != nil {
+		t.Fatalf("unexpected response error: %s", resp.Error)
+	}
+	sort.Strings(sampleQueries)
+	wantQueries := []string{
+		`_time:[1704067140, 1704067200] error | filter "service":="api"`,
+		`_time:[1704067140, 1704067200] error | filter "service":="web"`,
+	}
+	if len(sampleQueries) != len(wantQueries) || sampleQueries[0] != wantQueries[0] || sampleQueries[1] != wantQueries[1] {
+		t.Fatalf("unexpected sample queries %q; want %q", sampleQueries, wantQueries)
+	}
+	if len(resp.Frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(resp.Frames))
+	}
+
+	for _, frame := range resp.Frames {
+		if _, ok := frame.Fields[0].Labels[sampleLinesField]; ok {
+			t.Fatalf("sample lines mustn't change the series labels: %s", frame.Fields[0].Labels)
+		}
+	}
+	fd, _ := resp.Frames[0].FieldByName(sampleLinesField)
+	if fd == nil {
+		t.Fatalf("expected %s field", sampleLinesField)
+	}
+	if got, ok := fd.ConcreteAt(0); !ok || got != "first error\nsecond error" {
+		t.Fatalf("unexpected sample lines %q", got)
+	}
+	if fd, _ := resp.Frames[1].FieldByName(sampleLinesField); fd != nil {
+		t.Fatalf("unexpected sample lines for the series without logs")
+	}
+}
@@ -0,0 +1,306 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	// capabilitiesTTL is the time after which capabilities are detected again,
+	// e.g. after VictoriaLogs upgrade or downgrade
+	capabilitiesTTL = 5 * time.Minute
+	// capabilitiesTimeout limits the time of capabilities detection
+	capabilitiesTimeout = 30 * time.Second
+	// hitsOffsetProbeWindow is the time range of the hits offset probe
+	hitsOffsetProbeWindow = 5 * time.Minute
+)
+
+// tenantIDsMinVersion is the min VictoriaLogs version with /select/tenant_ids.
+// Other features are probed, since VictoriaLogs releases which added them aren't tracked here.
+var tenantIDsMinVersion = [3]int{1, 38, 0}
+
+// appVersionLabelRe matches labels of the vm_app_version metric
+var appVersionLabelRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// capabilities describes the VictoriaLogs server and the features it supports
+type capabilities struct {
+	// Version is the short VictoriaLogs version, e.g. v1.38.0, it is empty if /metrics isn't available
+	Version string `json:"version"`
+	Build   string `json:"build"`
+	// TenantIDs is true if /select/tenant_ids is supported
+	TenantIDs bool `json:"tenantIds"`
+	// Facets is true if /select/logsql/facets is supported
+	Facets bool `json:"facets"`
+	// HitsOffset is true if /select/logsql/hits supports the offset arg
+	HitsOffset bool `json:"hitsOffset"`
+}
+
+// capabilitiesCache contains capabilities detected per datasource instance for capabilitiesTTL
+type capabilitiesCache struct {
+	mu        sync.Mutex
+	caps      *capabilities
+	updatedAt time.Time
+	// call is the detection in progress, concurrent callers wait for its result
+	call *capabilitiesCall
+}
+
+// capabilitiesCall is a single capabilities detection shared by concurrent callers
+type capabilitiesCall struct {
+	done chan struct{}
+	caps *capabilities
+	err  error
+}
+
+// capabilities returns the cached capabilities of the VictoriaLogs server or detects them.
+// Expired capabilities are returned while they are detected again in the background,
+// so only the first call waits for the detection.
+// Concurrent callers share a single detection, the lock isn't held while VictoriaLogs is requested.
+// Capabilities aren't cached if VictoriaLogs is unreachable, so they are detected again on the next call.
+func (di *DatasourceInstance) capabilities(ctx context.Context) (*capabilities, error) {
+	di.caps.mu.Lock()
+	caps := di.caps.caps
+	if caps != nil && time.Since(di.caps.updatedAt) < capabilitiesTTL {
+		di.caps.mu.Unlock()
+		return caps, nil
+	}
+	call := di.caps.call
+	if call == nil {
+		call = &capabilitiesCall{done: make(chan struct{})}
+		di.caps.call = call
+		go di.detectCapabilitiesCall(call)
+	}
+	di.caps.mu.Unlock()
+
+	if caps != nil {
+		return caps, nil
+	}
+
+	select {
+	case <-call.done:
+		return call.caps, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// detectCapabilitiesCall detects capabilities for all the callers waiting for the call.
+// It doesn't depend on the context of a single caller, so its cancellation doesn't fail the others.
+func (di *DatasourceInstance) detectCapabilitiesCall(call *capabilitiesCall) {
+	ctx, cancel := context.WithTimeout(di.ctx, capabilitiesTimeout)
+	defer cancel()
+	call.caps, call.err = di.detectCapabilities(ctx)
+
+	di.caps.mu.Lock()
+	di.caps.call = nil
+	if call.err == nil {
+		di.caps.set(call.caps)
+	}
+	di.caps.mu.Unlock()
+	close(call.done)
+}
+
+// refreshCapabilities detects capabilities without the cache and updates the cache
+func (di *DatasourceInstance) refreshCapabilities(ctx context.Context) (*capabilities, error) {
+	caps, err := di.detectCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	di.caps.mu.Lock()
+	di.caps.set(caps)
+	di.caps.mu.Unlock()
+	return caps, nil
+}
+
+// set must be called under the lock
+func (cc *capabilitiesCache) set(caps *capabilities) {
+	backend.Logger.Debug("detected VictoriaLogs capabilities", "version", caps.Version,
+		"tenantIds", caps.TenantIDs, "facets", caps.Facets, "hitsOffset", caps.HitsOffset)
+	cc.caps = caps
+	cc.updatedAt = time.Now()
+}
+
+// detectCapabilities checks /select/tenant_ids support by the VictoriaLogs version
+// or by the endpoint probe if the version is unknown, e.g. /metrics isn't exposed by the proxy.
+// Facets and the hits offset are always probed.
+func (di *DatasourceInstance) detectCapabilities(ctx context.Context) (*capabilities, error) {
+	base, err := url.Parse(strings.TrimRight(di.settings.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse datasource URL: %w", err)
+	}
+
+	var caps capabilities
+	caps.Version, caps.Build, err = di.victoriaLogsVersion(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := parseVersion(caps.Version); ok {
+		caps.TenantIDs = !versionLess(v, tenantIDsMinVersion)
+	} else if caps.TenantIDs, err = di.probeEndpoint(ctx, base, tenantIDsPath, nil, false); err != nil {
+		// tenant headers are dropped the same way as in VLAPITenantIDs
+		return nil, err
+	}
+
+	facetsArgs := url.Values{"query": {"*"}, "start": {healthCheckStart}, "limit": {"1"}}
+	if caps.Facets, err = di.probeEndpoint(ctx, base, facetsQueryPath, facetsArgs, true); err != nil {
+		return nil, err
+	}
+	if caps.HitsOffset, err = di.probeHitsOffset(ctx, base); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// probeHitsOffset checks whether hourly hits buckets are shifted by the offset arg.
+// VictoriaLogs ignores unknown args, so buckets aligned to the hour mean the offset isn't supported.
+// The probe is limited to the last full 5 minutes and a single group, so it stays cheap on large installations.
+// The offset is considered supported if there are no logs, since the buckets can't be checked then.
+func (di *DatasourceInstance) probeHitsOffset(ctx context.Context, base *url.URL) (bool, error) {
+	method := di.grafanaSettings.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	end := time.Now().Truncate(time.Minute)
+	args := url.Values{
+		"query":        {"*"},
+		"start":        {end.Add(-hitsOffsetProbeWindow).Format(time.RFC3339)},
+		"end":          {end.Format(time.RFC3339)},
+		"step":         {"1h"},
+		"offset":       {"30m"},
+		"fields_limit": {"1"},
+	}
+	status, body, err := di.probeRequest(ctx, base, method, hitsQueryPath, args, true)
+	if err != nil {
+		return false, err
+	}
+	if status != http.StatusOK {
+		return true, nil
+	}
+	var hr HitsResponse
+	if err := json.Unmarshal(body, &hr); err != nil {
+		return true, nil
+	}
+	for _, hit := range hr.Hits {
+		for _, ts := range hit.Timestamps {
+			t, err := time.Parse(time.RFC3339, ts)
+			if err != nil {
+				continue
+			}
+			return !t.Equal(t.Truncate(time.Hour)), nil
+		}
+	}
+	return true, nil
+}
+
+// victoriaLogsVersion returns the VictoriaLogs version and build from the vm_app_version metric.
+// Empty strings are returned if /metrics isn't available, e.g. behind a proxy.
+func (di *DatasourceInstance) victoriaLogsVersion(ctx context.Context, base *url.URL) (string, string, error) {
+	status, body, err := di.probeRequest(ctx, base, http.MethodGet, metricsPath, nil, true)
+	if err != nil {
+		return "", "", err
+	}
+	if status != http.StatusOK {
+		return "", "", nil
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(line, "vm_app_version{") {
+			continue
+		}
+		var version, build string
+		for _, m := range appVersionLabelRe.FindAllStringSubmatch(line, -1) {
+			switch m[1] {
+			case "short_version":
+				version = m[2]
+			case "version":
+				build = m[2]
+			}
+		}
+		return version, build, nil
+	}
+	return "", "", nil
+}
+
+// probeEndpoint checks whether VictoriaLogs supports the endpoint.
+// The endpoint is supported if it returns a JSON response with 200 status code,
+// since VictoriaLogs may return a plain text error for unsupported paths.
+func (di *DatasourceInstance) probeEndpoint(ctx context.Context, base *url.URL, endpoint string, args url.Values, withTenant bool) (bool, error) {
+	method := di.grafanaSettings.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	status, body, err := di.probeRequest(ctx, base, method, endpoint, args, withTenant)
+	if err != nil {
+		return false, err
+	}
+	return status == http.StatusOK && json.Valid(body), nil
+}
+
+// parseVersion parses the short VictoriaLogs version, e.g. v1.38.0 or v1.38.0-cluster
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func versionLess(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// Capabilities returns the capabilities of the VictoriaLogs server
+func (d *Datasource) Capabilities(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pluginCxt := backend.PluginConfigFromContext(ctx)
+
+	di, err := d.getInstance(ctx, pluginCxt)
+	if err != nil {
+		d.logger.Error("Error loading datasource", "error", err)
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
+
+	caps, err := di.capabilities(ctx)
+	if err != nil {
+		writeError(rw, http.StatusBadGateway, fmt.Errorf("failed to detect VictoriaLogs capabilities: %w", err))
+		return
+	}
+	b, err := json.Marshal(caps)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write(b); err != nil {
+		d.logger.Warn("Error writing response", "error", err)
+	}
+}
@@ -0,0 +1,247 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestDatasourceInstance_capabilities(t *testing.T) {
+	type opts struct {
+		metrics   string
+		tenantIDs string
+		facets    bool
+		hits      string
+		want      capabilities
+	}
+	f := func(opts opts) {
+		t.Helper()
+		var requests atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			if opts.metrics == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(opts.metrics))
+		})
+		mux.HandleFunc("/select/tenant_ids", func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			_, _ = w.Write([]byte(opts.tenantIDs))
+		})
+		mux.HandleFunc("/select/logsql/hits", func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if r.FormValue("offset") != "30m" || r.FormValue("step") != "1h" || r.FormValue("fields_limit") != "1" ||
+				r.FormValue("start") == "" || r.FormValue("end") == "" {
+				t.Errorf("unexpected hits probe args: %s", r.URL.RawQuery)
+			}
+			hits := opts.hits
+			if hits == "" {
+				hits = `{"hits":[]}`
+			}
+			_, _ = w.Write([]byte(hits))
+		})
+		mux.HandleFunc("/select/logsql/facets", func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			if !opts.facets {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("unsupported path requested: /select/logsql/facets"))
+				return
+			}
+			_, _ = w.Write([]byte(`{"facets":[]}`))
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		ctx := context.Background()
+		d := NewDatasource()
+		di, err := d.getInstance(ctx, backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      srv.URL,
+				JSONData: []byte(`{}`),
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected instance error: %s", err)
+		}
+		got, err := di.capabilities(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(*got, opts.want) {
+			t.Fatalf("unexpected capabilities\n got: %+v\nwant: %+v", *got, opts.want)
+		}
+
+		// capabilities are cached
+		n := requests.Load()
+		if _, err := di.capabilities(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if requests.Load() != n {
+			t.Fatalf("expected cached capabilities")
+		}
+
+		// expired capabilities are returned while they are detected again in the background
+		di.caps.mu.Lock()
+		di.caps.updatedAt = time.Now().Add(-capabilitiesTTL)
+		di.caps.mu.Unlock()
+		stale, err := di.capabilities(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stale != got {
+			t.Fatalf("expected expired capabilities to be returned")
+		}
+		di.caps.mu.Lock()
+		call := di.caps.call
+		di.caps.mu.Unlock()
+		if call != nil {
+			<-call.done
+		}
+		if requests.Load() != 2*n {
+			t.Fatalf("expected capabilities to be detected again after the ttl")
+		}
+	}
+
+	// new version
+	o := opts{
+		metrics: `vm_app_version{version="victoria-logs-20250101-120000-tags-v1.38.0-0-gabcdef", short_version="v1.38.0"} 1`,
+		facets:  true,
+		hits:    `{"hits":[{"fields":{},"timestamps":["2024-12-31T23:30:00Z"],"values":[3],"total":3}]}`,
+		want: capabilities{
+			Version:    "v1.38.0",
+			Build:      "victoria-logs-20250101-120000-tags-v1.38.0-0-gabcdef",
+			TenantIDs:  true,
+			Facets:     true,
+			HitsOffset: true,
+		},
+	}
+	f(o)
+
+	// version without tenant_ids and facets, the hits offset is ignored
+	o = opts{
+		metrics: `vm_app_version{version="victoria-logs-20250501-120000-tags-v1.22.0-0-gabcdef", short_version="v1.22.0"} 1`,
+		hits:    `{"hits":[{"fields":{},"timestamps":["2024-12-31T23:00:00Z"],"values":[3],"total":3}]}`,
+		want: capabilities{
+			Version: "v1.22.0",
+			Build:   "victoria-logs-20250501-120000-tags-v1.22.0-0-gabcdef",
+		},
+	}
+	f(o)
+
+	// the hits offset is considered supported without logs
+	o = opts{
+		metrics: `vm_app_version{version="victoria-logs-20240101-120000-tags-v0.5.0-victorialogs-0-gabcdef", short_version="v0.5.0-victorialogs"} 1`,
+		want: capabilities{
+			Version:    "v0.5.0-victorialogs",
+			Build:      "victoria-logs-20240101-120000-tags-v0.5.0-victorialogs-0-gabcdef",
+			HitsOffset: true,
+		},
+	}
+	f(o)
+
+	// unknown version, tenant_ids is probed
+	o = opts{
+		tenantIDs: `unsupported path requested: /select/tenant_ids`,
+		facets:    true,
+		want: capabilities{
+			Facets:     true,
+			HitsOffset: true,
+		},
+	}
+	f(o)
+	o = opts{
+		tenantIDs: `[{"account_id":0,"project_id":0}]`,
+		want: capabilities{
+			TenantIDs:  true,
+			HitsOffset: true,
+		},
+	}
+	f(o)
+}
+
+func TestDatasourceInstance_capabilitiesConcurrent(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			requests.Add(1)
+			<-release
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	d := NewDatasource()
+	di, err := d.getInstance(ctx, backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected instance error: %s", err)
+	}
+
+	// a caller with the canceled context doesn't wait for the slow detection
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := di.capabilities(canceledCtx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the lock isn't held during the detection
+	di.caps.mu.Lock()
+	di.caps.mu.Unlock()
+
+	// concurrent callers share a single detection
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := di.capabilities(ctx); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected a single detection, got %d", n)
+	}
+}
+
+func TestDatasourceInstance_capabilitiesUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srvURL := srv.URL
+	srv.Close()
+
+	ctx := context.Background()
+	d := NewDatasource()
+	di, err := d.getInstance(ctx, backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srvURL,
+			JSONData: []byte(`{}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected instance error: %s", err)
+	}
+	if _, err := di.capabilities(ctx); err == nil {
+		t.Fatalf("expected error for unreachable VictoriaLogs")
+	}
+	if di.caps.caps != nil {
+		t.Fatalf("expected capabilities of unreachable VictoriaLogs not to be cached")
+	}
+}
@@ -1,7 +1,6 @@
 package plugin
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
@@ -21,6 +21,8 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
 )
 
 var (
@@ -38,6 +40,11 @@ const (
 	requestFromAlert = "FromAlert"
 	accountIDHeader  = "AccountID"
 	projectIDHeader  = "ProjectID"
+
+	// defaultTailBatchSize is the default max number of tailed rows sent in a single frame
+	defaultTailBatchSize = 100
+	// defaultTailFlushInterval is the default interval for sending incomplete frames of tailed rows
+	defaultTailFlushInterval = 250 * time.Millisecond
 )
 
 // Datasource describes a plugin service that manages DatasourceInstance entities
@@ -55,13 +62,13 @@ func NewDatasource() *Datasource {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", ds.RootHandler)
-	mux.HandleFunc("/select/logsql/field_values", ds.VLAPIQuery)
-	mux.HandleFunc("/select/logsql/field_names", ds.VLAPIQuery)
-	mux.HandleFunc("/select/logsql/streams", ds.VLAPIQuery)
-	mux.HandleFunc("/select/logsql/stream_field_names", ds.VLAPIQuery)
-	mux.HandleFunc("/select/logsql/stream_field_values", ds.VLAPIQuery)
+	// endpoints and their args are checked against the proxy allowlist, see ProxyEndpoint
+	mux.HandleFunc(proxyPathPrefix, ds.VLAPIQuery)
+	mux.HandleFunc(facetsQueryPath, ds.VLAPIFacets)
 	mux.HandleFunc("/select/tenant_ids", ds.VLAPITenantIDs)
 	mux.HandleFunc("/vmui", ds.VMUIQuery)
+	mux.HandleFunc("/capabilities", ds.Capabilities)
+	mux.HandleFunc("/log_context", ds.LogContext)
 	ds.CallResourceHandler = httpadapter.New(mux)
 	return &ds
 }
@@ -111,11 +118,18 @@ func newDatasourceInstance(ctx context.Context, settings backend.DataSourceInsta
 		return nil, err
 	}
 
+	// the instance context must outlive the request which created the instance
+	instanceCtx, cancel := context.WithCancel(context.Background())
 	return &DatasourceInstance{
+		ctx:                 instanceCtx,
+		cancel:              cancel,
 		settings:            dstSettings,
 		httpClient:          cl,
 		httpStreamingClient: strCl,
 		grafanaSettings:     grafanaSettings,
+		derivedFields:       newDerivedFields(grafanaSettings.DerivedFields),
+		tails:               newTailMux(instanceCtx),
+		liveStreams:         newLiveStreams(grafanaSettings.MaxLiveStreams, grafanaSettings.MaxLiveStreamsPerUser),
 	}, nil
 }
 
@@ -127,10 +141,23 @@ type MultitenancyHeaders struct {
 // GrafanaSettings contains the raw DataSourceConfig as JSON as stored by Grafana server.
 // It repeats the properties in this object and includes custom properties.
 type GrafanaSettings struct {
-	HTTPMethod          string              `json:"httpMethod"`
-	QueryParams         string              `json:"customQueryParameters"`
-	CustomHeaders       http.Header         `json:"-"`
-	MultitenancyHeaders MultitenancyHeaders `json:"-"`
+	HTTPMethod            string               `json:"httpMethod"`
+	QueryParams           string               `json:"customQueryParameters"`
+	DerivedFields         []DerivedFieldConfig `json:"derivedFields"`
+	TailBatchSize         int                  `json:"tailBatchSize"`
+	TailFlushInterval     string               `json:"tailFlushInterval"`
+	TailBufferSize        int                  `json:"tailBufferSize"`
+	TailDropPolicy        string               `json:"tailDropPolicy"`
+	DisableLiveMode       bool                 `json:"disableLiveMode"`
+	MaxLiveStreams        int                  `json:"maxLiveStreams"`
+	MaxLiveStreamsPerUser int                  `json:"maxLiveStreamsPerUser"`
+	ProxyEndpoints        []ProxyEndpoint      `json:"proxyEndpoints"`
+	CustomHeaders         http.Header          `json:"-"`
+	MultitenancyHeaders   MultitenancyHeaders  `json:"-"`
+
+	tailBatch      tailBatch
+	tailBuffer     tailBuffer
+	proxyAllowlist *proxyAllowlist
 }
 
 func NewGrafanaSettings(settings backend.DataSourceInstanceSettings) (*GrafanaSettings, error) {
@@ -160,18 +187,70 @@ func NewGrafanaSettings(settings backend.DataSourceInstanceSettings) (*GrafanaSe
 	if grafanaSettings.HTTPMethod == "" {
 		grafanaSettings.HTTPMethod = http.MethodGet
 	}
+
+	grafanaSettings.tailBatch = tailBatch{
+		maxRows:       defaultTailBatchSize,
+		flushInterval: defaultTailFlushInterval,
+	}
+	if grafanaSettings.TailBatchSize > 0 {
+		grafanaSettings.tailBatch.maxRows = grafanaSettings.TailBatchSize
+	}
+	if grafanaSettings.TailFlushInterval != "" {
+		interval, err := utils.ParseDuration(grafanaSettings.TailFlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tail flush interval: %w", err)
+		}
+		if interval > 0 {
+			grafanaSettings.tailBatch.flushInterval = interval
+		}
+	}
+
+	grafanaSettings.tailBuffer = tailBuffer{
+		size: defaultTailBufferSize,
+	}
+	if grafanaSettings.TailBufferSize > 0 {
+		grafanaSettings.tailBuffer.size = grafanaSettings.TailBufferSize
+	}
+	grafanaSettings.tailBuffer.policy, err = parseTailDropPolicy(grafanaSettings.TailDropPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if grafanaSettings.MaxLiveStreams <= 0 {
+		grafanaSettings.MaxLiveStreams = defaultMaxLiveStreams
+	}
+	if grafanaSettings.MaxLiveStreamsPerUser <= 0 {
+		grafanaSettings.MaxLiveStreamsPerUser = defaultMaxLiveStreamsPerUser
+	}
+
+	grafanaSettings.proxyAllowlist, err = newProxyAllowlist(grafanaSettings.ProxyEndpoints, grafanaSettings.QueryParams)
+	if err != nil {
+		return nil, err
+	}
 	return &grafanaSettings, nil
 }
 
 // DatasourceInstance is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type DatasourceInstance struct {
+	// ctx is canceled on Dispose, all the upstream requests are derived from it,
+	// so they stop using the old client and settings, see requestContext
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	settings DataSourceInstanceSettings
 
 	httpClient          *http.Client
 	httpStreamingClient *http.Client
 	grafanaSettings     *GrafanaSettings
+	derivedFields       []*derivedField
 	liveModeResponses   sync.Map
+	// tails shares upstream tail connections between live streams with the same query
+	tails *tailMux
+	// liveStreams limits the number of running live streams
+	liveStreams *liveStreams
+	// caps contains the detected capabilities of the VictoriaLogs server
+	caps capabilitiesCache
 }
 
 type DataSourceInstanceSettings struct {
@@ -186,11 +265,38 @@ type DataSourceInstanceSettings struct {
 // managed channel path – thus plugin can check subscribe permissions and communicate
 // options with Grafana Core. As soon as first subscriber joins channel RunStream
 // will be called.
+// The subscription is rejected if the query is invalid, the live mode is disabled
+// or the user has reached the limit of concurrent live streams.
 func (d *Datasource) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
 	di, err := d.getInstance(ctx, req.PluginContext)
 	if err != nil {
 		return nil, err
 	}
+
+	q, err := getQueryFromRaw(req.Data, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := di.validateLiveQuery(q); err != nil {
+		return nil, fmt.Errorf("invalid live query: %w", err)
+	}
+
+	user := liveStreamUser(req.PluginContext)
+	if di.grafanaSettings.DisableLiveMode {
+		backend.Logger.Warn("live stream subscription rejected: live mode is disabled", "path", req.Path, "user", user)
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusPermissionDenied,
+		}, nil
+	}
+	// the slot is reserved here, since Grafana calls SubscribeStream for every subscriber
+	// and RunStream only for the first one; it is released when RunStream returns
+	if err := di.liveStreams.subscribe(req.Path, user); err != nil {
+		backend.Logger.Warn("live stream subscription rejected", "path", req.Path, "user", user, "error", err)
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusPermissionDenied,
+		}, nil
+	}
+
 	ch := make(chan *data.Frame, 1)
 	di.liveModeResponses.Store(req.Path, ch)
 	return &backend.SubscribeStreamResponse{
@@ -198,6 +304,16 @@ func (d *Datasource) SubscribeStream(ctx context.Context, req *backend.Subscribe
 	}, nil
 }
 
+// requestContext returns the request context which is also canceled when the instance is disposed
+func (di *DatasourceInstance) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(di.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
 // getInstance Returns cached datasource or creates new one
 func (d *Datasource) getInstance(ctx context.Context, pluginContext backend.PluginContext) (*DatasourceInstance, error) {
 	instance, err := d.im.Get(ctx, pluginContext)
@@ -234,23 +350,66 @@ func (d *Datasource) RunStream(ctx context.Context, req *backend.RunStreamReques
 	// RunStream call, so a re-subscribe that stores a new channel under the same
 	// path cannot prevent the old channel from being closed, and Dispose can
 	// never double-close (or close mid-write) a channel owned by a running stream.
+	// the stream takes the slots reserved by SubscribeStream before the channel is removed,
+	// so a subscription of the same path can't reserve them again meanwhile
+	channel, err := di.liveStreams.start(req.Path, liveStreamUser(req.PluginContext))
+	if err != nil {
+		if ch, ok := di.liveModeResponses.LoadAndDelete(req.Path); ok {
+			close(ch.(chan *data.Frame))
+		}
+		return err
+	}
+	defer di.liveStreams.stop(channel)
+
 	ch, ok := di.liveModeResponses.LoadAndDelete(req.Path)
 	if !ok {
 		return fmt.Errorf("failed to find the channel for the query: %s", req.Path)
 	}
 	livestream := ch.(chan *data.Frame)
-	// closing the channel stops the frame-forwarding goroutine below;
-	// safe because streamQuery (the only writer) has already returned
-	defer close(livestream)
+	// the query is validated by streamQuery
+	q, _ := getQueryFromRaw(req.Data, false)
+	liveStats := q != nil && q.isLiveStats()
+
+	sent := make(chan struct{})
+	defer func() {
+		// closing the channel stops the frame-forwarding goroutines below;
+		// safe because streamQuery (the only writer) has already returned
+		close(livestream)
+		// wait for the last frames, e.g. the notice about the disposed instance
+		<-sent
+	}()
+	// the queue decouples streamQuery from the client,
+	// so a slow client doesn't stall the stream unless the block policy is used.
+	// Live stats frames contain only the changed buckets, so they are sent directly and never dropped.
+	next := func() (*data.Frame, bool) {
+		frame, ok := <-livestream
+		return frame, ok
+	}
+	if !liveStats {
+		queue := newTailQueue(req.Path, di.grafanaSettings.tailBuffer)
+		go func() {
+			for frame := range livestream {
+				queue.push(frame)
+			}
+			queue.close()
+		}()
+		next = queue.pop
+	}
 	go func() {
+		defer close(sent)
 		prev := data.FrameJSONCache{}
 		var canceled bool
-		for frame := range livestream {
+		for {
+			frame, ok := next()
+			if !ok {
+				return
+			}
 			if canceled {
 				// keep draining so streamQuery never blocks on send;
 				// the loop ends when RunStream closes the channel on return
 				continue
 			}
+			applyDerivedFields(data.Frames{frame}, di.derivedFields)
 			next, _ := data.FrameToJSONCache(frame)
 			var err error
 			if next.SameSchema(&prev) {
@@ -273,7 +432,21 @@ func (d *Datasource) RunStream(ctx context.Context, req *backend.RunStreamReques
 		}
 	}()
 
-	if err := di.streamQuery(ctx, req, livestream); err != nil {
+	streamCtx, cancel := di.requestContext(ctx)
+	defer cancel()
+	err = di.streamQuery(streamCtx, req, livestream)
+	if di.ctx.Err() != nil && ctx.Err() == nil {
+		// the instance was disposed, so the stream must be started again with the new settings
+		backend.Logger.Info("live stream stopped because the datasource instance was disposed", "path", req.Path)
+		const notice = "Live stream stopped because the datasource settings changed, run the query again"
+		if liveStats {
+			livestream <- newLiveStatsNoticeFrame(notice)
+		} else {
+			livestream <- newTailNoticeFrame(notice)
+		}
+		return nil
+	}
+	if err != nil {
 		return fmt.Errorf("failed to parse stream response: %w", err)
 	}
 
@@ -284,6 +457,8 @@ func (d *Datasource) RunStream(ctx context.Context, req *backend.RunStreamReques
 // created. As soon as datasource settings change detected by SDK old datasource instance will
 // be disposed and a new one will be created using NewSampleDatasource factory function.
 func (di *DatasourceInstance) Dispose() {
+	// Stop running streams and in-flight requests, they use the old settings.
+	di.cancel()
 	// Clean up datasource instance resources.
 	di.httpClient.CloseIdleConnections()
 	di.httpStreamingClient.CloseIdleConnections()
@@ -316,6 +491,9 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 		return nil, err
 	}
 
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	for _, q := range req.Queries {
@@ -341,21 +519,157 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 
 // streamQuery sends a query to the datasource and parses the tail results
 // into the livestream channel owned by the calling RunStream.
+// Live streams with the same tail request share a single upstream connection, see tailMux.
+// When the established tail connection drops, it reconnects with backoff
+// and resumes from the last delivered row until the context is canceled.
+// Stats range and hits queries are executed periodically instead, see streamStatsQuery.
 func (di *DatasourceInstance) streamQuery(ctx context.Context, request *backend.RunStreamRequest, livestream chan *data.Frame) error {
 	q, err := getQueryFromRaw(request.Data, false)
 	if err != nil {
 		return err
 	}
+	if q.isLiveStats() {
+		return di.streamStatsQuery(ctx, request, livestream)
+	}
+	key, err := di.tailKey(q)
+	if err != nil {
+		return err
+	}
 
-	r, err := di.datasourceQuery(ctx, q, true)
+	backfill := func(ctx context.Context, cursor *tailCursor) {
+		if err := di.backfillTail(ctx, request, livestream, cursor); err != nil && ctx.Err() == nil {
+			backend.Logger.Warn("failed to backfill live tail", "path", request.Path, "error", err)
+		}
+	}
+	return di.tails.run(ctx, key, livestream, di.grafanaSettings.tailBuffer, backfill, func(ctx context.Context, out chan *data.Frame) error {
+		return di.tailStream(ctx, request, out)
+	})
+}
+
+// tailKey returns the key of the shared tail for the query.
+// It consists of the tenant and the tail URL, which has sorted query args.
+func (di *DatasourceInstance) tailKey(q *Query) (string, error) {
+	tailURL, err := q.queryTailURL(di.settings.URL, di.grafanaSettings.QueryParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request URL: %w", err)
+	}
+	tenant := di.grafanaSettings.MultitenancyHeaders
+	return tenant.AccountID + ":" + tenant.ProjectID + "/" + tailURL, nil
+}
+
+// tailStream runs the tail and reconnects it when the established connection drops,
+// tailed rows are sent to the livestream channel until the context is canceled.
+func (di *DatasourceInstance) tailStream(ctx context.Context, request *backend.RunStreamRequest, livestream chan *data.Frame) error {
+	cursor := newTailCursor()
+	backoff := tailReconnectMinBackoff
+	var connected bool
+	for {
+		ok, err := di.tailQuery(ctx, request, livestream, cursor)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if ok {
+			connected = true
+			backoff = tailReconnectMinBackoff
+		}
+		if err != nil && !connected {
+			// the tail was never established, most likely the query or the datasource settings are wrong
+			return err
+		}
+		var permanent *tailDataError
+		if errors.As(err, &permanent) {
+			return err
+		}
+
+		reason := "connection closed"
+		if err != nil {
+			reason = err.Error()
+		}
+		backend.Logger.Warn("live tail connection lost, reconnecting", "path", request.Path, "backoff", backoff, "reason", reason)
+		livestream <- newTailNoticeFrame("Live tail connection lost (%s), reconnecting in %s", reason, backoff)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+		backoff = nextTailBackoff(backoff)
+	}
+}
+
+// tailDataError is returned for the tail responses which can't be parsed,
+// reconnecting doesn't help in this case
+type tailDataError struct {
+	err error
+}
+
+func (e *tailDataError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tailDataError) Unwrap() error {
+	return e.err
+}
+
+// backfillTail sends the most recent log lines after the live stream joined the tail,
+// the sent rows are registered in the cursor, so they are skipped in the tail.
+// The backfill is set either as the number of lines within tailBackfillWindow
+// or as the time window limited by the max lines of the query.
+// It is executed for every live stream, since the upstream tail may be shared.
+func (di *DatasourceInstance) backfillTail(ctx context.Context, request *backend.RunStreamRequest, livestream chan *data.Frame, cursor *tailCursor) error {
+	q, err := getQueryFromRaw(request.Data, false)
 	if err != nil {
 		return err
 	}
+	lines, window, err := q.tailBackfill()
+	if err != nil || (lines == 0 && window <= 0) {
+		return err
+	}
 
+	now := time.Now()
+	q.QueryType = QueryTypeInstant
+	if lines > 0 {
+		q.MaxLines = lines
+		window = tailBackfillWindow
+	}
+	q.TimeRange = backend.TimeRange{From: now.Add(-window), To: now}
+	r, err := di.datasourceQuery(ctx, q, false)
+	if err != nil {
+		return err
+	}
 	if r == nil {
-		// VictoriaLogs returned no data
 		return nil
 	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			backend.Logger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	return parseTailBackfillResponse(r, livestream, di.grafanaSettings.tailBatch, cursor)
+}
+
+// tailQuery runs a single tail request resumed from the cursor.
+// It returns true if the connection was established.
+func (di *DatasourceInstance) tailQuery(ctx context.Context, request *backend.RunStreamRequest, livestream chan *data.Frame, cursor *tailCursor) (bool, error) {
+	q, err := getQueryFromRaw(request.Data, false)
+	if err != nil {
+		return false, &tailDataError{err: err}
+	}
+	q.tailStartOffset = cursor.startOffset(time.Now())
+	cursor.resume()
+
+	r, err := di.datasourceQuery(ctx, q, true)
+	if err != nil {
+		return false, err
+	}
+
+	if r == nil {
+		// VictoriaLogs returned no data
+		return true, nil
+	}
 
 	defer func() {
 		if err := r.Close(); err != nil {
@@ -363,7 +677,14 @@ func (di *DatasourceInstance) streamQuery(ctx context.Context, request *backend.
 		}
 	}()
 
-	return parseStreamResponse(r, livestream)
+	tr := &tailReader{r: r}
+	if err := parseStreamResponse(tr, livestream, di.grafanaSettings.tailBatch, cursor); err != nil {
+		if tr.err != nil {
+			return true, tr.err
+		}
+		return true, &tailDataError{err: err}
+	}
+	return true, nil
 }
 
 // getQueryFromRaw parses the query json from the raw message.
@@ -447,6 +768,18 @@ func (di *DatasourceInstance) datasourceQuery(ctx context.Context, q *Query, isS
 
 // query sends a query to the datasource and returns the result.
 func (di *DatasourceInstance) query(ctx context.Context, q *Query) backend.DataResponse {
+	if q.QueryType == QueryTypeHits && q.TimezoneOffset != "" {
+		if caps, err := di.capabilities(ctx); err == nil && !caps.HitsOffset {
+			// buckets are aligned without the timezone offset by old VictoriaLogs
+			q.TimezoneOffset = ""
+		}
+	}
+	if q.QueryType == QueryTypeFacets {
+		if caps, err := di.capabilities(ctx); err == nil && !caps.Facets {
+			return di.facetsFallbackQuery(ctx, q)
+		}
+	}
+
 	r, err := di.datasourceQuery(ctx, q, false)
 	if err != nil {
 		return newResponseError(err, backend.StatusInternal)
@@ -464,14 +797,25 @@ func (di *DatasourceInstance) query(ctx context.Context, q *Query) backend.DataR
 	}()
 
 	switch q.QueryType {
-	case QueryTypeStats:
-		return parseStatsResponse(r, q)
-	case QueryTypeStatsRange:
-		return parseStatsResponse(r, q)
+	case QueryTypeStats, QueryTypeStatsRange:
+		resp := parseStatsResponse(r, q)
+		if resp.Error == nil && q.ForAlerting && q.AlertSampleLines > 0 {
+			di.attachSampleLines(ctx, q, resp.Frames)
+		}
+		return resp
 	case QueryTypeHits:
-		return parseHitsResponse(r)
+		return parseHitsResponse(r, q)
+	case QueryTypeAnnotations:
+		return parseAnnotationsResponse(r, q)
+	case QueryTypeFacets:
+		return parseFacetsResponse(r, q)
 	default:
-		return parseInstantResponse(r)
+		if q.ForAlerting {
+			return parseLogsAlertingResponse(r, q)
+		}
+		resp := parseInstantResponse(r)
+		applyDerivedFields(resp.Frames, di.derivedFields)
+		return resp
 	}
 }
 
@@ -505,6 +849,8 @@ func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRe
 		d.logger.Error("Error getting datasource instance", "err", err)
 		return res, nil
 	}
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
 	return checkHealthWithInstance(ctx, di)
 }
 
@@ -530,18 +876,24 @@ func (d *Datasource) VLAPIQuery(rw http.ResponseWriter, req *http.Request) {
 		}
 	}()
 
-	fieldsQuery, err := getFieldsQueryFromRaw(req.Body)
+	di, err := d.getInstance(ctx, pluginCxt)
 	if err != nil {
+		d.logger.Error("Error loading datasource", "error", err)
 		writeError(rw, http.StatusInternalServerError, err)
 		return
 	}
 
-	di, err := d.getInstance(ctx, pluginCxt)
+	params, err := di.grafanaSettings.proxyAllowlist.params(req.URL.Path, req.Body)
 	if err != nil {
-		d.logger.Error("Error loading datasource", "error", err)
-		writeError(rw, http.StatusInternalServerError, err)
+		if errors.Is(err, errProxyEndpointNotAllowed) {
+			writeError(rw, http.StatusNotFound, err)
+			return
+		}
+		writeError(rw, http.StatusBadRequest, err)
 		return
 	}
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
 
 	u, err := url.Parse(di.settings.URL)
 	if err != nil {
@@ -549,7 +901,12 @@ func (d *Datasource) VLAPIQuery(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	u.Path = path.Join(u.Path, req.URL.Path)
-	u.RawQuery = fieldsQuery.queryParams().Encode()
+	// the query of the datasource URL is kept like for the data queries
+	values := u.Query()
+	for k, v := range params {
+		values[k] = v
+	}
+	u.RawQuery = values.Encode()
 	newReq, err := http.NewRequestWithContext(ctx, req.Method, u.String(), nil)
 	if err != nil {
 		writeError(rw, http.StatusBadRequest, fmt.Errorf("failed to create new request with context: %w", err))
@@ -622,6 +979,21 @@ func (d *Datasource) VLAPITenantIDs(rw http.ResponseWriter, req *http.Request) {
 		_, err = rw.Write([]byte(`{"hint": "To use the list of possible tenants, need to set the datasource url first and save the datasource configuration"}`))
 		return
 	}
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
+
+	caps, err := di.capabilities(ctx)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("failed to detect VictoriaLogs capabilities: %w", err))
+		return
+	}
+	if !caps.TenantIDs {
+		// VictoriaLogs < 1.38.0 doesn't support /select/tenant_ids endpoint
+		rw.Header().Add("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, err = rw.Write([]byte(`{}`))
+		return
+	}
 
 	u, err := url.Parse(di.settings.URL)
 	if err != nil {
@@ -655,14 +1027,6 @@ func (d *Datasource) VLAPITenantIDs(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	rw.Header().Add("Content-Type", "application/json")
-	// VictoriaLogs returns error message with 200 status code for unsupported paths
-	// this hack is for the VictoriaLogs < 1.38.0 which doesn't support /select/tenant_ids endpoint
-	if bytes.Contains(bodyBytes, []byte("unsupported path requested:")) {
-		rw.WriteHeader(http.StatusOK)
-		_, err = rw.Write([]byte(`{}`))
-		return
-	}
-
 	rw.WriteHeader(http.StatusOK)
 	_, err = rw.Write(bodyBytes)
 	if err != nil {
@@ -829,53 +1193,6 @@ func buildDatasourceSettings(settings backend.DataSourceInstanceSettings) (DataS
 	return dstSettings, nil
 }
 
-func checkHealthWithInstance(ctx context.Context, di *DatasourceInstance) (*backend.CheckHealthResult, error) {
-	u, err := url.Parse(strings.TrimRight(di.settings.URL, "/"))
-	if err != nil {
-		return newHealthCheckErrorf("failed to parse datasource URL: %s", err), nil
-	}
-	u.Path = path.Join(u.Path, instantQueryPath)
-
-	values := u.Query()
-	values.Set("query", "*")
-	values.Set("limit", "1")
-	values.Set("start", "-5m")
-	u.RawQuery = values.Encode()
-
-	method := di.grafanaSettings.HTTPMethod
-	if method == "" {
-		method = http.MethodGet
-	}
-
-	r, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
-	if err != nil {
-		return newHealthCheckErrorf("could not create request: %s", err), nil
-	}
-	// CustomHeaders includes multitenancy headers (AccountID, ProjectID) and user-defined headers.
-	r.Header = di.grafanaSettings.CustomHeaders.Clone()
-
-	resp, err := di.httpClient.Do(r)
-	if err != nil {
-		return newHealthCheckErrorf("request error: %s", err), nil
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.DefaultLogger.Error("check health: failed to close response body", "err", err.Error())
-		}
-	}()
-	if resp.StatusCode != http.StatusOK {
-		body, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return newHealthCheckErrorf("got response code %d, failed to read body: %s", resp.StatusCode, readErr), nil
-		}
-		return newHealthCheckErrorf("got response code %d: %s", resp.StatusCode, string(body)), nil
-	}
-	return &backend.CheckHealthResult{
-		Status:  backend.HealthStatusOk,
-		Message: "Data source is working",
-	}, nil
-}
-
 func parseMultitenancyHeaders(settings backend.DataSourceInstanceSettings) (MultitenancyHeaders, error) {
 	defaults := MultitenancyHeaders{
 		AccountID: "0",
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -505,15 +506,20 @@ func TestDatasourceStreamQueryRequest(t *testing.T) {
 				t.Fatalf("error write reposne: %s", err)
 			}
 		case 4:
-			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z"}`))
+			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z"}` + "\n"))
 			if err != nil {
 				t.Fatalf("error write reposne: %s", err)
 			}
+			w.(http.Flusher).Flush()
+			// keep the connection open like the live tail does
+			<-r.Context().Done()
 		case 5:
-			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z", "job": "vlogs"}`))
+			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z", "job": "vlogs"}` + "\n"))
 			if err != nil {
 				t.Fatalf("error write reposne: %s", err)
 			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
 		}
 	})
 
@@ -527,14 +533,18 @@ func TestDatasourceStreamQueryRequest(t *testing.T) {
 	pluginCtx := backend.PluginContext{
 		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
 			URL:      srv.URL,
-			JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":""}`),
+			JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":"","tailFlushInterval":"5ms"}`),
 		},
 	}
 	expErr := func(ctx context.Context, e string) {
+		// the live tail runs until the client leaves
+		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
 		_ = packetSender.Reset()
 		_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
 			PluginContext: pluginCtx,
 			Path:          "request_id/ref_id",
+			Data:          json.RawMessage(`{"expr":"*","refId":"A"}`),
 		})
 		err := d.RunStream(ctx, &backend.RunStreamRequest{
 			PluginContext: pluginCtx,
@@ -695,19 +705,146 @@ func TestDatasourceStreamQueryRequest(t *testing.T) {
 
 }
 
+func TestDatasourceSubscribeStream(t *testing.T) {
+	type opts struct {
+		jsonData string
+		data     string
+		user     string
+		// running is the number of live streams already started by the user
+		running    int
+		wantStatus backend.SubscribeStreamStatus
+		wantErr    bool
+	}
+	f := func(opts opts) {
+		t.Helper()
+		ctx := context.Background()
+		d := NewDatasource()
+		pluginCtx := backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      "http://127.0.0.1:9428",
+				JSONData: []byte(opts.jsonData),
+			},
+			User: &backend.User{Login: opts.user},
+		}
+		di, err := d.getInstance(ctx, pluginCtx)
+		if err != nil {
+			t.Fatalf("unexpected instance error: %s", err)
+		}
+		for i := 0; i < opts.running; i++ {
+			if err := di.liveStreams.subscribe(fmt.Sprintf("running/%d", i), opts.user); err != nil {
+				t.Fatalf("unexpected subscribe error: %s", err)
+			}
+		}
+
+		resp, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
+			PluginContext: pluginCtx,
+			Path:          "request_id/ref_id",
+			Data:          json.RawMessage(opts.data),
+		})
+		if (err != nil) != opts.wantErr {
+			t.Fatalf("SubscribeStream() error = %v, wantErr %v", err, opts.wantErr)
+		}
+		if err != nil {
+			return
+		}
+		if resp.Status != opts.wantStatus {
+			t.Fatalf("unexpected status %v; want %v", resp.Status, opts.wantStatus)
+		}
+		_, ok := di.liveModeResponses.Load("request_id/ref_id")
+		if ok != (opts.wantStatus == backend.SubscribeStreamStatusOK) {
+			t.Fatalf("unexpected channel registration: %v", ok)
+		}
+	}
+
+	// valid live tail
+	o := opts{
+		jsonData:   `{}`,
+		data:       `{"expr":"*","refId":"A"}`,
+		user:       "admin",
+		wantStatus: backend.SubscribeStreamStatusOK,
+	}
+	f(o)
+
+	// valid live stats
+	o = opts{
+		jsonData:   `{}`,
+		data:       `{"expr":"* | stats count()","refId":"A","queryType":"statsRange","step":"1m"}`,
+		user:       "admin",
+		wantStatus: backend.SubscribeStreamStatusOK,
+	}
+	f(o)
+
+	// malformed query
+	o = opts{
+		jsonData: `{}`,
+		data:     `{"expr":`,
+		wantErr:  true,
+	}
+	f(o)
+
+	// missing query
+	o = opts{
+		jsonData: `{}`,
+		data:     `{"expr":" ","refId":"A"}`,
+		wantErr:  true,
+	}
+	f(o)
+
+	// invalid backfill
+	o = opts{
+		jsonData: `{}`,
+		data:     `{"expr":"*","refId":"A","tailBackfill":"abc"}`,
+		wantErr:  true,
+	}
+	f(o)
+
+	// live mode is disabled
+	o = opts{
+		jsonData:   `{"disableLiveMode":true}`,
+		data:       `{"expr":"*","refId":"A"}`,
+		wantStatus: backend.SubscribeStreamStatusPermissionDenied,
+	}
+	f(o)
+
+	// the user reached the limit
+	o = opts{
+		jsonData:   `{"maxLiveStreamsPerUser":2}`,
+		data:       `{"expr":"*","refId":"A"}`,
+		user:       "admin",
+		running:    2,
+		wantStatus: backend.SubscribeStreamStatusPermissionDenied,
+	}
+	f(o)
+
+	// the datasource reached the limit
+	o = opts{
+		jsonData:   `{"maxLiveStreams":1}`,
+		data:       `{"expr":"*","refId":"A"}`,
+		user:       "admin",
+		running:    1,
+		wantStatus: backend.SubscribeStreamStatusPermissionDenied,
+	}
+	f(o)
+}
+
 func TestRunStreamCleansUpLiveChannel(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/select/logsql/tail", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs\"}","_time":"2024-02-20T14:04:27Z"}`))
+		_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs\"}","_time":"2024-02-20T14:04:27Z"}` + "\n"))
 		if err != nil {
 			t.Fatalf("error write response: %s", err)
 		}
+		w.(http.Flusher).Flush()
+		// keep the connection open like the live tail does
+		<-r.Context().Done()
 	})
 
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
 
-	ctx := context.Background()
+	// the live tail runs until the client leaves
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
 	d := NewDatasource()
 	sender := backend.NewStreamSender(&mockStreamSender{packets: []json.RawMessage{}})
 	pluginCtx := backend.PluginContext{
@@ -718,7 +855,7 @@ func TestRunStreamCleansUpLiveChannel(t *testing.T) {
 	}
 
 	const path = "request_id/ref_id/0-abc1234"
-	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path}); err != nil {
+	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path, Data: json.RawMessage(`{"expr":"*","refId":"A"}`)}); err != nil {
 		t.Fatalf("unexpected subscribe error: %s", err)
 	}
 
@@ -774,13 +911,17 @@ func TestRunStreamClosesReplacedChannel(t *testing.T) {
 		w.(http.Flusher).Flush()
 		close(handlerStarted)
 		// keep the tail connection open until the test has re-subscribed
-		<-releaseHandler
+		select {
+		case <-releaseHandler:
+		case <-r.Context().Done():
+		}
 	})
 
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	d := NewDatasource()
 	sender := backend.NewStreamSender(&mockStreamSender{packets: []json.RawMessage{}})
 	pluginCtx := backend.PluginContext{
@@ -791,7 +932,7 @@ func TestRunStreamClosesReplacedChannel(t *testing.T) {
 	}
 
 	const path = "request_id/ref_id/0-abc1234"
-	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path}); err != nil {
+	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path, Data: json.RawMessage(`{"expr":"*","refId":"A"}`)}); err != nil {
 		t.Fatalf("unexpected subscribe error: %s", err)
 	}
 
@@ -822,7 +963,7 @@ func TestRunStreamClosesReplacedChannel(t *testing.T) {
 	}
 
 	// simulate a client reconnect: the same path gets a new channel
-	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path}); err != nil {
+	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path, Data: json.RawMessage(`{"expr":"*","refId":"A"}`)}); err != nil {
 		t.Fatalf("unexpected re-subscribe error: %s", err)
 	}
 	newVal, ok := di.liveModeResponses.Load(path)
@@ -834,7 +975,8 @@ func TestRunStreamClosesReplacedChannel(t *testing.T) {
 		t.Fatalf("expected re-subscribe to register a new channel")
 	}
 
-	// let the tail response end so RunStream returns
+	// the client leaves, so RunStream returns
+	cancel()
 	close(releaseHandler)
 	select {
 	case err := <-runStreamDone:
@@ -865,6 +1007,134 @@ func TestRunStreamClosesReplacedChannel(t *testing.T) {
 	}
 }
 
+func TestRunStreamStopsOnDispose(t *testing.T) {
+	handlerStarted := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/tail", func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		close(handlerStarted)
+		<-r.Context().Done()
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDatasource()
+	packetSender := &mockStreamSender{packets: []json.RawMessage{}}
+	sender := backend.NewStreamSender(packetSender)
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{"httpMethod":"POST"}`),
+		},
+	}
+
+	const path = "request_id/ref_id/0-abc1234"
+	query := json.RawMessage(`{"expr":"*","refId":"A"}`)
+	if _, err := d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{PluginContext: pluginCtx, Path: path, Data: query}); err != nil {
+		t.Fatalf("unexpected subscribe error: %s", err)
+	}
+	di, err := d.getInstance(ctx, pluginCtx)
+	if err != nil {
+		t.Fatalf("unexpected instance error: %s", err)
+	}
+
+	runStreamDone := make(chan error, 1)
+	go func() {
+		runStreamDone <- d.RunStream(ctx, &backend.RunStreamRequest{
+			PluginContext: pluginCtx,
+			Path:          path,
+			Data:          query,
+		}, sender)
+	}()
+	select {
+	case <-handlerStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the tail handler to be called")
+	}
+
+	// the datasource settings have changed
+	di.Dispose()
+	select {
+	case err := <-runStreamDone:
+		if err != nil {
+			t.Fatalf("unexpected stream error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected RunStream to return after dispose")
+	}
+
+	stream := packetSender.GetStream()
+	if len(stream) == 0 {
+		t.Fatalf("expected the notice about changed settings")
+	}
+	var frame data.Frame
+	if err := frame.UnmarshalJSON(stream[len(stream)-1]); err != nil {
+		t.Fatalf("cannot unmarshal frame: %s", err)
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || !strings.Contains(frame.Meta.Notices[0].Text, "datasource settings changed") {
+		t.Fatalf("unexpected notice frame %v", frame.Meta)
+	}
+}
+
+func TestQueryDataStopsOnDispose(t *testing.T) {
+	handlerStarted := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(_ http.ResponseWriter, r *http.Request) {
+		close(handlerStarted)
+		<-r.Context().Done()
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	d := NewDatasource()
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{"httpMethod":"POST"}`),
+		},
+	}
+	di, err := d.getInstance(ctx, pluginCtx)
+	if err != nil {
+		t.Fatalf("unexpected instance error: %s", err)
+	}
+
+	queryDone := make(chan *backend.QueryDataResponse, 1)
+	go func() {
+		resp, err := d.QueryData(ctx, &backend.QueryDataRequest{
+			PluginContext: pluginCtx,
+			Queries: []backend.DataQuery{{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+				JSON:      json.RawMessage(`{"expr":"*","refId":"A","queryType":"instant"}`),
+			}},
+		})
+		if err != nil {
+			t.Errorf("unexpected query error: %s", err)
+		}
+		queryDone <- resp
+	}()
+	select {
+	case <-handlerStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the query handler to be called")
+	}
+
+	di.Dispose()
+	select {
+	case resp := <-queryDone:
+		if resp == nil || resp.Responses["A"].Error == nil {
+			t.Fatalf("expected the canceled query to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected QueryData to return after dispose")
+	}
+}
+
 func TestDatasourceStreamRequestWithRetry(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(_ http.ResponseWriter, _ *http.Request) {
@@ -878,18 +1148,23 @@ func TestDatasourceStreamRequestWithRetry(t *testing.T) {
 		c++
 		switch c {
 		case 0:
-			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z"}`))
+			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z"}` + "\n"))
 			if err != nil {
 				t.Fatalf("error write reposne: %s", err)
 			}
+			w.(http.Flusher).Flush()
+			// keep the connection open like the live tail does
+			<-r.Context().Done()
 		case 1:
 			conn, _, _ := w.(http.Hijacker).Hijack()
 			_ = conn.Close()
 		case 2:
-			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z", "job": "vlogs"}`))
+			_, err := w.Write([]byte(`{"_msg":"123","_stream":"{application=\"logs-benchmark-Apache.log-1708437847\",hostname=\"e28a622d7792\"}","_time":"2024-02-20T14:04:27Z", "job": "vlogs"}` + "\n"))
 			if err != nil {
 				t.Fatalf("error write reposne: %s", err)
 			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
 		case 3:
 			conn, _, _ := w.(http.Hijacker).Hijack()
 			_ = conn.Close()
@@ -909,13 +1184,14 @@ func TestDatasourceStreamRequestWithRetry(t *testing.T) {
 	pluginCtx := backend.PluginContext{
 		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
 			URL:      srv.URL,
-			JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":""}`),
+			JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":"","tailFlushInterval":"5ms"}`),
 		},
 	}
 	expErr := func(e string) {
 		_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
 			PluginContext: pluginCtx,
 			Path:          "request_id/ref_id",
+			Data:          json.RawMessage(`{"expr":"*","refId":"A"}`),
 		})
 		err := d.RunStream(ctx, &backend.RunStreamRequest{
 			PluginContext: pluginCtx,
@@ -943,10 +1219,14 @@ func TestDatasourceStreamRequestWithRetry(t *testing.T) {
 	}
 
 	expValue := func() {
+		// the live tail runs until the client leaves
+		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
 		_ = packetSender.Reset()
 		_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
 			PluginContext: pluginCtx,
 			Path:          "request_id/ref_id",
+			Data:          json.RawMessage(`{"expr":"*","refId":"A"}`),
 		})
 		err := d.RunStream(ctx, &backend.RunStreamRequest{
 			PluginContext: pluginCtx,
@@ -1103,7 +1383,7 @@ func TestDatasourceStreamTailProcess(t *testing.T) {
 		t.Fatalf("should not be called")
 	})
 
-	mux.HandleFunc("/select/logsql/tail", func(w http.ResponseWriter, _ *http.Request) {
+	mux.HandleFunc("/select/logsql/tail", func(w http.ResponseWriter, r *http.Request) {
 		// we send 3 messages with 20ms delay
 		// simulate tail stream response
 		for i := 0; i < 3; i++ {
@@ -1111,26 +1391,33 @@ func TestDatasourceStreamTailProcess(t *testing.T) {
 			if err != nil {
 				t.Fatalf("error write reposne: %s", err)
 			}
+			w.(http.Flusher).Flush()
 			time.Sleep(20 * time.Millisecond)
 		}
+		// keep the connection open like the live tail does
+		<-r.Context().Done()
 	})
 
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
 
-	ctx := context.Background()
+	// the live tail runs until the client leaves
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
 	d := NewDatasource()
 	packetSender := &mockStreamSender{packets: []json.RawMessage{}}
 	sender := backend.NewStreamSender(packetSender)
+	// rows are sent every 20ms, so the short flush interval sends every row in its own frame
 	pluginCtx := backend.PluginContext{
 		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
 			URL:      srv.URL,
-			JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":""}`),
+			JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":"","tailFlushInterval":"5ms"}`),
 		},
 	}
 	_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
 		PluginContext: pluginCtx,
 		Path:          "request_id/ref_id",
+		Data:          json.RawMessage(`{"expr":"*","refId":"A"}`),
 	})
 	if err := d.RunStream(ctx, &backend.RunStreamRequest{
 		PluginContext: pluginCtx,
@@ -1161,6 +1448,203 @@ func TestDatasourceStreamTailProcess(t *testing.T) {
 	}
 }
 
+func TestDatasourceStreamTailResume(t *testing.T) {
+	defaultBackoff := tailReconnectMinBackoff
+	tailReconnectMinBackoff = 10 * time.Millisecond
+	defer func() {
+		tailReconnectMinBackoff = defaultBackoff
+	}()
+
+	writeRows := func(w http.ResponseWriter, msgs ...string) {
+		for _, msg := range msgs {
+			_, err := fmt.Fprintf(w, `{"_msg":%q,"_stream":"{app=\"api\"}","_time":"2024-02-20T14:04:27Z"}`+"\n", msg)
+			if err != nil {
+				t.Errorf("error write response: %s", err)
+			}
+		}
+		w.(http.Flusher).Flush()
+	}
+	var mu sync.Mutex
+	var startOffsets []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/tail", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		mu.Lock()
+		startOffsets = append(startOffsets, r.Form.Get("start_offset"))
+		c := len(startOffsets)
+		mu.Unlock()
+
+		switch c {
+		case 1:
+			// the connection is closed by a proxy
+			writeRows(w, "first", "second")
+		case 2, 3:
+			// VictoriaLogs is restarting, the request and its retry fail
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		case 4:
+			// the resumed tail returns the already delivered row again
+			writeRows(w, "second", "third")
+			<-r.Context().Done()
+		default:
+			<-r.Context().Done()
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDatasource()
+	packetSender := &mockStreamSender{packets: []json.RawMessage{}}
+	sender := backend.NewStreamSender(packetSender)
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{"httpMethod":"POST","tailFlushInterval":"5ms"}`),
+		},
+	}
+	_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
+		PluginContext: pluginCtx,
+		Path:          "request_id/ref_id",
+		Data:          json.RawMessage(`{"expr":"*","refId":"A"}`),
+	})
+
+	runStreamDone := make(chan error, 1)
+	go func() {
+		runStreamDone <- d.RunStream(ctx, &backend.RunStreamRequest{
+			PluginContext: pluginCtx,
+			Path:          "request_id/ref_id",
+			Data:          json.RawMessage(`{"expr":"*","refId":"A"}`),
+		}, sender)
+	}()
+
+	var lines []string
+	var notices int
+	deadline := time.After(5 * time.Second)
+	for len(lines) < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected 3 lines, got %q", lines)
+		case <-time.After(10 * time.Millisecond):
+		}
+		lines, notices = lines[:0], 0
+		for _, packet := range packetSender.GetStream() {
+			var frame data.Frame
+			if err := frame.UnmarshalJSON(packet); err != nil {
+				t.Fatalf("cannot unmarshal frame: %s", err)
+			}
+			if frame.Meta != nil {
+				notices += len(frame.Meta.Notices)
+			}
+			lineFd, _ := frame.FieldByName(gLineField)
+			for i := 0; i < frame.Rows(); i++ {
+				lines = append(lines, lineFd.At(i).(string))
+			}
+		}
+	}
+
+	cancel()
+	if err := <-runStreamDone; err != nil {
+		t.Fatalf("unexpected stream error: %s", err)
+	}
+
+	if !reflect.DeepEqual(lines, []string{"first", "second", "third"}) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if notices != 2 {
+		t.Fatalf("expected 2 reconnect notices, got %d", notices)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if startOffsets[0] != "" {
+		t.Fatalf("unexpected start_offset of the first request %q", startOffsets[0])
+	}
+	if startOffsets[len(startOffsets)-1] == "" {
+		t.Fatalf("expected start_offset in the resumed request")
+	}
+}
+
+func TestDatasourceStreamTailBackfill(t *testing.T) {
+	row := func(msg, ts string) string {
+		return fmt.Sprintf(`{"_msg":%q,"_stream":"{app=\"api\"}","_time":%q}`+"\n", msg, ts)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		if r.Form.Get("limit") != "2" {
+			t.Errorf("unexpected limit %q", r.Form.Get("limit"))
+		}
+		if r.Form.Get("extra_filters") != `{"job":"app"}` {
+			t.Errorf("unexpected extra_filters %q", r.Form.Get("extra_filters"))
+		}
+		// the most recent logs aren't sorted
+		_, _ = w.Write([]byte(row("second", "2024-02-20T14:04:28Z") + row("first", "2024-02-20T14:04:27Z")))
+	})
+	mux.HandleFunc("/select/logsql/tail", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		if r.Form.Get("extra_filters") != `{"job":"app"}` {
+			t.Errorf("unexpected extra_filters %q", r.Form.Get("extra_filters"))
+		}
+		// the tail may be shared with other live streams, so it doesn't depend on the backfill
+		if r.Form.Get("start_offset") != "" {
+			t.Errorf("unexpected start_offset %q", r.Form.Get("start_offset"))
+		}
+		_, _ = w.Write([]byte(row("third", "2024-02-20T14:04:29Z")))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	d := NewDatasource()
+	packetSender := &mockStreamSender{packets: []json.RawMessage{}}
+	sender := backend.NewStreamSender(packetSender)
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{"httpMethod":"POST","tailFlushInterval":"5ms"}`),
+		},
+	}
+	_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
+		PluginContext: pluginCtx,
+		Path:          "request_id/ref_id",
+		Data:          json.RawMessage(`{"expr":"*","refId":"A","tailBackfill":"2","extraFilters":"{\"job\":\"app\"}"}`),
+	})
+	if err := d.RunStream(ctx, &backend.RunStreamRequest{
+		PluginContext: pluginCtx,
+		Path:          "request_id/ref_id",
+		Data:          json.RawMessage(`{"expr":"*","refId":"A","tailBackfill":"2","extraFilters":"{\"job\":\"app\"}"}`),
+	}, sender); err != nil {
+		t.Fatalf("unexpected stream error: %s", err)
+	}
+
+	var lines []string
+	for _, packet := range packetSender.GetStream() {
+		var frame data.Frame
+		if err := frame.UnmarshalJSON(packet); err != nil {
+			t.Fatalf("cannot unmarshal frame: %s", err)
+		}
+		lineFd, _ := frame.FieldByName(gLineField)
+		for i := 0; i < frame.Rows(); i++ {
+			lines = append(lines, lineFd.At(i).(string))
+		}
+	}
+	if !reflect.DeepEqual(lines, []string{"first", "second", "third"}) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
+
 func TestDatasource_checkAlertingRequest(t *testing.T) {
 	type opts struct {
 		headers map[string]string
@@ -1512,7 +1996,7 @@ func TestVLAPIQuery_ContentEncoding(t *testing.T) {
 			}
 
 			ctx := backend.WithPluginContext(context.Background(), pluginCtx)
-			req := httptest.NewRequest(http.MethodGet, "/api/v1/field_values", bytes.NewReader([]byte("{}")))
+			req := httptest.NewRequest(http.MethodGet, "/select/logsql/field_values", bytes.NewReader([]byte("{}")))
 			req = req.WithContext(ctx)
 
 			rr := httptest.NewRecorder()
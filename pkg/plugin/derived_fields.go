@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	derivedFieldMatcherLabel = "label"
+	derivedFieldMatcherRegex = "regex"
+)
+
+// types of the link target datasources with their own query models
+const (
+	pluginID                   = "victoriametrics-logs-datasource"
+	tempoDatasourceType        = "tempo"
+	xrayDatasourceType         = "grafana-x-ray-datasource"
+	derivedFieldURLPlaceholder = "Need to provide url in the datasource settings"
+)
+
+// DerivedFieldConfig describes a field which is extracted from the log line or labels
+// and rendered as a link. It is configured on the datasource settings page.
+type DerivedFieldConfig struct {
+	MatcherRegex    string `json:"matcherRegex"`
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	URLDisplayLabel string `json:"urlDisplayLabel"`
+	DatasourceUID   string `json:"datasourceUid"`
+	// DatasourceType is the type of the link target datasource, it is set by the settings editor
+	DatasourceType string `json:"datasourceType"`
+	MatcherType    string `json:"matcherType"`
+}
+
+// derivedField contains all DerivedFieldConfig entries sharing the same name.
+// Like in the frontend, the value is matched by the first config of the group
+// and every config of the group contributes a link.
+type derivedField struct {
+	name        string
+	matcherType string
+	labelName   string
+	re          *regexp.Regexp
+	links       []data.DataLink
+}
+
+// newDerivedFields groups configs by name and compiles their matchers.
+// Groups with regular expressions which can't be compiled by Go (e.g. JS-only syntax)
+// are skipped, so they keep working in the frontend and don't break the datasource.
+func newDerivedFields(configs []DerivedFieldConfig) []*derivedField {
+	var fields []*derivedField
+	byName := make(map[string]*derivedField)
+	skipped := make(map[string]struct{})
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			continue
+		}
+		if _, ok := skipped[cfg.Name]; ok {
+			// the first config of the group is the matcher, the following ones can't replace it
+			continue
+		}
+		df, ok := byName[cfg.Name]
+		if !ok {
+			df = &derivedField{
+				name:        cfg.Name,
+				matcherType: cfg.MatcherType,
+			}
+			switch cfg.MatcherType {
+			case derivedFieldMatcherLabel:
+				df.labelName = cfg.MatcherRegex
+			case derivedFieldMatcherRegex, "":
+				re, err := regexp.Compile(cfg.MatcherRegex)
+				if err != nil {
+					backend.Logger.Warn("skipping derived field with invalid regex", "name", cfg.Name, "regex", cfg.MatcherRegex, "error", err)
+					skipped[cfg.Name] = struct{}{}
+					continue
+				}
+				df.re = re
+			}
+			byName[cfg.Name] = df
+			fields = append(fields, df)
+		}
+		if link, ok := cfg.dataLink(); ok {
+			df.links = append(df.links, link)
+		}
+	}
+	return fields
+}
+
+// dataLink builds an internal Explore link if the datasource uid is set
+// or an external link otherwise
+func (cfg DerivedFieldConfig) dataLink() (data.DataLink, bool) {
+	if cfg.DatasourceUID != "" {
+		return data.DataLink{
+			Title: cfg.URLDisplayLabel,
+			Internal: &data.InternalDataLink{
+				Query:         cfg.internalQuery(),
+				DatasourceUID: cfg.DatasourceUID,
+			},
+		}, true
+	}
+	if cfg.URL != "" {
+		return data.DataLink{
+			Title: cfg.URLDisplayLabel,
+			URL:   cfg.URL,
+		}, true
+	}
+	return data.DataLink{}, false
+}
+
+// internalQuery returns the query of the internal link in the model of the target datasource
+// the same way as buildInternalLink in the frontend
+func (cfg DerivedFieldConfig) internalQuery() map[string]any {
+	query := cfg.URL
+	if query == "" {
+		query = derivedFieldURLPlaceholder
+	}
+	switch cfg.DatasourceType {
+	case tempoDatasourceType:
+		return map[string]any{"refId": "A", "query": query, "queryType": "traceql"}
+	case xrayDatasourceType:
+		return map[string]any{"refId": "A", "query": query, "queryType": "getTrace"}
+	case pluginID:
+		return map[string]any{"refId": "A", "expr": cfg.URL}
+	case "":
+		// the type isn't saved by older versions of the settings editor,
+		// so the query is set for both query models used by Grafana datasources
+		return map[string]any{"refId": "A", "expr": cfg.URL, "query": query}
+	default:
+		return map[string]any{"refId": "A", "query": query}
+	}
+}
+
+// applyDerivedFields appends derived fields with data links to the log frames
+func applyDerivedFields(frames data.Frames, derived []*derivedField) {
+	if len(derived) == 0 {
+		return
+	}
+	for _, frame := range frames {
+		lineField, _ := frame.FieldByName(gLineField)
+		if lineField == nil {
+			continue
+		}
+		labelsField, _ := frame.FieldByName(gLabelsField)
+
+		rows := lineField.Len()
+		fields := make([]*data.Field, len(derived))
+		for i, df := range derived {
+			fields[i] = data.NewFieldFromFieldType(data.FieldTypeNullableString, rows)
+			fields[i].Name = df.name
+			fields[i].Config = &data.FieldConfig{Links: df.links}
+		}
+
+		var parser fastjson.Parser
+		for row := 0; row < rows; row++ {
+			var labels *fastjson.Value
+			for i, df := range derived {
+				var value string
+				switch {
+				case df.re != nil:
+					line, _ := lineField.ConcreteAt(row)
+					s, _ := line.(string)
+					m := df.re.FindStringSubmatch(s)
+					if len(m) < 2 || m[1] == "" {
+						continue
+					}
+					value = m[1]
+				case df.matcherType == derivedFieldMatcherLabel && labelsField != nil:
+					if labels == nil {
+						labels = parseLabelsAt(&parser, labelsField, row)
+					}
+					if labels == nil || !labels.Exists(df.labelName) {
+						continue
+					}
+					value = string(labels.GetStringBytes(df.labelName))
+				default:
+					continue
+				}
+				fields[i].Set(row, &value)
+			}
+		}
+
+		frame.Fields = append(frame.Fields, fields...)
+	}
+}
+
+// parseLabelsAt returns the labels object of the given row or nil if it can't be parsed
+func parseLabelsAt(parser *fastjson.Parser, labelsField *data.Field, row int) *fastjson.Value {
+	raw, ok := labelsField.ConcreteAt(row)
+	if !ok {
+		return nil
+	}
+	b, ok := raw.(json.RawMessage)
+	if !ok {
+		return nil
+	}
+	v, err := parser.ParseBytes(b)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		return nil
+	}
+	return v
+}
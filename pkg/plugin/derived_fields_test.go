@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func Test_applyDerivedFields(t *testing.T) {
+	type opts struct {
+		configs []DerivedFieldConfig
+		lines   []string
+		labels  []string
+		want    func() []*data.Field
+	}
+	f := func(opts opts) {
+		t.Helper()
+		frame := newLogFrame()
+		for i, line := range opts.lines {
+			frame.append(logRow{Time: time.Unix(0, 0), Line: line, Labels: json.RawMessage(opts.labels[i])})
+		}
+		base := len(frame.dataFrame.Fields)
+
+		applyDerivedFields(data.Frames{frame.dataFrame}, newDerivedFields(opts.configs))
+
+		got, err := data.NewFrame("", frame.dataFrame.Fields[base:]...).MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal fields: %s", err)
+		}
+		want, err := data.NewFrame("", opts.want()...).MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal want fields: %s", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("\n got value: %s, \n want value: %s", got, want)
+		}
+	}
+
+	str := func(s string) *string { return &s }
+
+	// no configs
+	o := opts{
+		lines:  []string{"traceID=abc"},
+		labels: []string{`{}`},
+		want: func() []*data.Field {
+			return []*data.Field{}
+		},
+	}
+	f(o)
+
+	// regex matcher with external link
+	o = opts{
+		configs: []DerivedFieldConfig{
+			{Name: "traceID", MatcherRegex: `traceID=(\w+)`, URL: "http://tracing/${__value.raw}", URLDisplayLabel: "Trace"},
+		},
+		lines:  []string{"traceID=abc", "no trace"},
+		labels: []string{`{}`, `{}`},
+		want: func() []*data.Field {
+			fd := data.NewField("traceID", nil, []*string{str("abc"), nil})
+			fd.Config = &data.FieldConfig{Links: []data.DataLink{{Title: "Trace", URL: "http://tracing/${__value.raw}"}}}
+			return []*data.Field{fd}
+		},
+	}
+	f(o)
+
+	// label matcher with internal link, configs with the same name are grouped
+	o = opts{
+		configs: []DerivedFieldConfig{
+			{Name: "trace", MatcherType: derivedFieldMatcherLabel, MatcherRegex: "trace_id", DatasourceUID: "tempo", URL: "${__value.raw}"},
+			{Name: "trace", MatcherType: derivedFieldMatcherLabel, MatcherRegex: "ignored", URL: "http://tracing/${__value.raw}"},
+		},
+		lines:  []string{"first", "second"},
+		labels: []string{`{"trace_id":"123"}`, `{"service":"api"}`},
+		want: func() []*data.Field {
+			fd := data.NewField("trace", nil, []*string{str("123"), nil})
+			fd.Config = &data.FieldConfig{Links: []data.DataLink{
+				{Internal: &data.InternalDataLink{
+					Query:         map[string]any{"refId": "A", "expr": "${__value.raw}", "query": "${__value.raw}"},
+					DatasourceUID: "tempo",
+				}},
+				{URL: "http://tracing/${__value.raw}"},
+			}}
+			return []*data.Field{fd}
+		},
+	}
+	f(o)
+
+	// internal links use the query model of the target datasource
+	o = opts{
+		configs: []DerivedFieldConfig{
+			{Name: "trace", MatcherType: derivedFieldMatcherLabel, MatcherRegex: "trace_id", DatasourceUID: "tempo", DatasourceType: tempoDatasourceType, URL: "${__value.raw}"},
+			{Name: "trace", DatasourceUID: "xray", DatasourceType: xrayDatasourceType, URL: "${__value.raw}"},
+			{Name: "trace", DatasourceUID: "logs", DatasourceType: pluginID, URL: `trace_id:"${__value.raw}"`},
+			{Name: "trace", DatasourceUID: "jaeger", DatasourceType: "jaeger"},
+		},
+		lines:  []string{"first"},
+		labels: []string{`{"trace_id":"123"}`},
+		want: func() []*data.Field {
+			fd := data.NewField("trace", nil, []*string{str("123")})
+			fd.Config = &data.FieldConfig{Links: []data.DataLink{
+				{Internal: &data.InternalDataLink{
+					Query:         map[string]any{"refId": "A", "query": "${__value.raw}", "queryType": "traceql"},
+					DatasourceUID: "tempo",
+				}},
+				{Internal: &data.InternalDataLink{
+					Query:         map[string]any{"refId": "A", "query": "${__value.raw}", "queryType": "getTrace"},
+					DatasourceUID: "xray",
+				}},
+				{Internal: &data.InternalDataLink{
+					Query:         map[string]any{"refId": "A", "expr": `trace_id:"${__value.raw}"`},
+					DatasourceUID: "logs",
+				}},
+				{Internal: &data.InternalDataLink{
+					Query:         map[string]any{"refId": "A", "query": derivedFieldURLPlaceholder},
+					DatasourceUID: "jaeger",
+				}},
+			}}
+			return []*data.Field{fd}
+		},
+	}
+	f(o)
+
+	// the group with the invalid regex in the first config is skipped entirely
+	o = opts{
+		configs: []DerivedFieldConfig{
+			{Name: "user", MatcherRegex: `(?<=user=)\w+`, URL: "http://example"},
+			{Name: "user", MatcherRegex: `user=(\w+)`, URL: "http://other"},
+		},
+		lines:  []string{"user=bob"},
+		labels: []string{`{}`},
+		want: func() []*data.Field {
+			return []*data.Field{}
+		},
+	}
+	f(o)
+
+	// regex which can't be compiled by Go is skipped
+	o = opts{
+		configs: []DerivedFieldConfig{
+			{Name: "bad", MatcherRegex: `(?<=id=)\w+`, URL: "http://example"},
+			{Name: "user", MatcherType: derivedFieldMatcherRegex, MatcherRegex: `user=(\w+)`},
+		},
+		lines:  []string{"user=bob"},
+		labels: []string{`{}`},
+		want: func() []*data.Field {
+			fd := data.NewField("user", nil, []*string{str("bob")})
+			fd.Config = &data.FieldConfig{}
+			return []*data.Field{fd}
+		},
+	}
+	f(o)
+}
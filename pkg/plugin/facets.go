@@ -0,0 +1,291 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// defaultFacetsLimit is the number of values per field returned by VictoriaLogs facets by default
+	defaultFacetsLimit = 10
+	// defaultFacetsMaxValuesPerField is the number of unique values above which
+	// VictoriaLogs facets skip the field by default
+	defaultFacetsMaxValuesPerField = 1000
+	// maxFacetsFallbackFields limits the number of field_values requests made instead of a single facets request
+	maxFacetsFallbackFields = 20
+	// facetsFallbackConcurrency limits the number of concurrent field_values requests
+	facetsFallbackConcurrency = 5
+)
+
+// FacetsOptions describes the most frequent field values returned by the facets query type
+type FacetsOptions struct {
+	// Limit is the number of the most frequent values returned per field
+	Limit int `json:"limit"`
+	// MaxValuesPerField skips fields with more unique values, e.g. trace ids
+	MaxValuesPerField int `json:"maxValuesPerField"`
+	// KeepConstFields returns fields with a single value in all matching logs
+	KeepConstFields bool `json:"keepConstFields"`
+}
+
+// fieldHits is a single entry of /select/logsql/field_names and /select/logsql/field_values responses
+type fieldHits struct {
+	Value string `json:"value"`
+	Hits  uint64 `json:"hits"`
+}
+
+// facetsFallbackQuery returns facets of the query for VictoriaLogs without /select/logsql/facets
+func (di *DatasourceInstance) facetsFallbackQuery(ctx context.Context, q *Query) backend.DataResponse {
+	if _, err := q.getQueryURL(di.settings.URL, di.grafanaSettings.QueryParams); err != nil {
+		err = fmt.Errorf("failed to create request URL: %w", err)
+		return newResponseError(err, backend.StatusInternal)
+	}
+	facets, skipped, err := di.facetsFallback(ctx, q.url.Query(), q.Fields)
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+	fr := FacetsResponse{Facets: facets, SkippedFields: skipped}
+	frame := fr.getDataFrame(q)
+	if fr.SkippedFields > 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text: fmt.Sprintf("facets are built only for the first %d fields by hits, %d fields were skipped, since this VictoriaLogs version doesn't support /select/logsql/facets; select the fields to show",
+				maxFacetsFallbackFields, fr.SkippedFields),
+		})
+	}
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// facetsFallback builds facets from /select/logsql/field_names and /select/logsql/field_values
+// for VictoriaLogs without /select/logsql/facets. The args are the args of the facets request.
+// Only the given fields are requested if they are set. Fields above maxFacetsFallbackFields
+// are skipped, their number is returned.
+func (di *DatasourceInstance) facetsFallback(ctx context.Context, args url.Values, fields []string) ([]Facet, int, error) {
+	limit := defaultFacetsLimit
+	if n, err := strconv.Atoi(args.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	maxValues := defaultFacetsMaxValuesPerField
+	if n, err := strconv.Atoi(args.Get("max_values_per_field")); err == nil && n > 0 {
+		maxValues = n
+	}
+	keepConst, _ := strconv.ParseBool(args.Get("keep_const_fields"))
+
+	common := url.Values{}
+	for k, v := range args {
+		switch k {
+		case "limit", "max_values_per_field", "keep_const_fields":
+		default:
+			common[k] = v
+		}
+	}
+
+	names, err := di.fieldHitsRequest(ctx, fieldNamesPath, common)
+	if err != nil {
+		return nil, 0, err
+	}
+	sortFieldHits(names)
+
+	wanted := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		wanted[f] = struct{}{}
+	}
+	var requested []string
+	skipped := 0
+	for _, name := range names {
+		if _, ok := wanted[name.Value]; len(wanted) > 0 && !ok {
+			continue
+		}
+		if name.Value == "_time" {
+			// every log has its own timestamp
+			continue
+		}
+		if len(requested) >= maxFacetsFallbackFields {
+			skipped++
+			continue
+		}
+		requested = append(requested, name.Value)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*Facet, len(requested))
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	sem := make(chan struct{}, facetsFallbackConcurrency)
+	for i, name := range requested {
+		fieldArgs := url.Values{}
+		for k, v := range common {
+			fieldArgs[k] = v
+		}
+		fieldArgs.Set("field", name)
+		// one more value is requested to detect fields with too many unique values
+		fieldArgs.Set("limit", strconv.Itoa(maxValues+1))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			values, err := di.fieldHitsRequest(ctx, fieldValuesPath, fieldArgs)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			if len(values) > maxValues || (len(values) == 1 && !keepConst) {
+				return
+			}
+			sortFieldHits(values)
+			if len(values) > limit {
+				values = values[:limit]
+			}
+
+			facet := Facet{FieldName: name, Values: make([]FacetValue, 0, len(values))}
+			for _, v := range values {
+				facet.Values = append(facet.Values, FacetValue{FieldValue: v.Value, Hits: v.Hits})
+			}
+			results[i] = &facet
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// facets keep the order of fields by hits
+	facets := make([]Facet, 0, len(results))
+	for _, facet := range results {
+		if facet != nil {
+			facets = append(facets, *facet)
+		}
+	}
+	return facets, skipped, nil
+}
+
+// fieldHitsRequest sends the request to /select/logsql/field_names or /select/logsql/field_values
+func (di *DatasourceInstance) fieldHitsRequest(ctx context.Context, endpoint string, args url.Values) ([]fieldHits, error) {
+	u, err := url.Parse(di.settings.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse datasource url: %w", err)
+	}
+	u.Path = path.Join(u.Path, endpoint)
+	// the query of the datasource URL is kept like for the data queries
+	values := u.Query()
+	for k, v := range args {
+		values[k] = v
+	}
+	u.RawQuery = values.Encode()
+
+	method := di.grafanaSettings.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new request with context: %w", err)
+	}
+	req.Header = di.grafanaSettings.CustomHeaders.Clone()
+
+	resp, err := di.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make http request: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			backend.Logger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+		return nil, fmt.Errorf("%s returned status %d: %s", endpoint, resp.StatusCode, string(body))
+	}
+	var r struct {
+		Values []fieldHits `json:"values"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", endpoint, err)
+	}
+	return r.Values, nil
+}
+
+// sortFieldHits sorts by hits in descending order
+func sortFieldHits(values []fieldHits) {
+	sort.SliceStable(values, func(i, j int) bool {
+		if values[i].Hits != values[j].Hits {
+			return values[i].Hits > values[j].Hits
+		}
+		return values[i].Value < values[j].Value
+	})
+}
+
+// VLAPIFacets proxies /select/logsql/facets requests to VictoriaLogs.
+// Facets are built from field_names and field_values if VictoriaLogs doesn't support them.
+func (d *Datasource) VLAPIFacets(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pluginCxt := backend.PluginConfigFromContext(ctx)
+
+	di, err := d.getInstance(ctx, pluginCxt)
+	if err != nil {
+		d.logger.Error("Error loading datasource", "error", err)
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
+
+	if caps, err := di.capabilities(ctx); err != nil || caps.Facets {
+		// let VictoriaLogs report the error if capabilities can't be detected
+		d.VLAPIQuery(rw, req)
+		return
+	}
+
+	defer func() {
+		if err := req.Body.Close(); err != nil {
+			d.logger.Error("VLAPIFacets: failed to close request body", "err", err.Error())
+		}
+	}()
+	params, err := di.grafanaSettings.proxyAllowlist.params(facetsQueryPath, req.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	facets, skipped, err := di.facetsFallback(ctx, params, nil)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	b, err := json.Marshal(FacetsResponse{Facets: facets, SkippedFields: skipped})
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write(b); err != nil {
+		d.logger.Warn("Error writing response", "error", err)
+	}
+}
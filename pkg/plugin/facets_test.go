@@ -0,0 +1,290 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// newFacetsServer returns VictoriaLogs with or without facets support,
+// facets are available only via field_names and field_values without it
+func newFacetsServer(t *testing.T, facets bool) *httptest.Server {
+	t.Helper()
+	fieldValues := map[string]string{
+		"level":    `{"values":[{"value":"error","hits":1},{"value":"info","hits":2}]}`,
+		"app":      `{"values":[{"value":"api","hits":3}]}`,
+		"trace_id": `{"values":[{"value":"a","hits":1},{"value":"b","hits":1},{"value":"c","hits":1}]}`,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`vm_app_version{version="victoria-logs", short_version="v1.38.0"} 1`))
+	})
+	mux.HandleFunc("/select/logsql/facets", func(w http.ResponseWriter, r *http.Request) {
+		if !facets {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("unsupported path requested: /select/logsql/facets"))
+			return
+		}
+		if r.URL.Query().Get("query") == "*" {
+			// capabilities probe
+			_, _ = w.Write([]byte(`{"facets":[]}`))
+			return
+		}
+		if r.URL.Query().Get("query") != "level:*" {
+			t.Errorf("unexpected facets query %q", r.URL.Query().Get("query"))
+		}
+		_, _ = w.Write([]byte(`{"facets":[{"field_name":"level","values":[{"field_value":"info","hits":2}]}]}`))
+	})
+	mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("limit") {
+			t.Errorf("unexpected limit in field_names request")
+		}
+		_, _ = w.Write([]byte(`{"values":[{"value":"_time","hits":3},{"value":"app","hits":3},{"value":"level","hits":3},{"value":"trace_id","hits":3}]}`))
+	})
+	mux.HandleFunc("/select/logsql/field_values", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") != "level:*" {
+			t.Errorf("unexpected field_values query %q", r.URL.Query().Get("query"))
+		}
+		_, _ = w.Write([]byte(fieldValues[r.URL.Query().Get("field")]))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestDatasourceQueryFacets(t *testing.T) {
+	type opts struct {
+		facets     bool
+		query      string
+		wantFields []string
+		wantValues []string
+		wantHits   []uint64
+	}
+	f := func(opts opts) {
+		t.Helper()
+		srv := newFacetsServer(t, opts.facets)
+		defer srv.Close()
+
+		d := NewDatasource()
+		rsp, err := d.QueryData(context.Background(), &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+					URL:      srv.URL,
+					JSONData: []byte(`{"httpMethod":"GET"}`),
+				},
+			},
+			Queries: []backend.DataQuery{
+				{
+					RefID:     "A",
+					QueryType: string(QueryTypeFacets),
+					JSON:      []byte(opts.query),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		resp := rsp.Responses["A"]
+		if resp.Error != nil {
+			t.Fatalf("unexpected response error: %s", resp.Error)
+		}
+		if len(resp.Frames) != 1 {
+			t.Fatalf("expected a single frame, got %d", len(resp.Frames))
+		}
+		frame := resp.Frames[0]
+		var fields, values []string
+		var hits []uint64
+		for i := 0; i < frame.Rows(); i++ {
+			fields = append(fields, frame.Fields[0].At(i).(string))
+			values = append(values, frame.Fields[1].At(i).(string))
+			hits = append(hits, frame.Fields[2].At(i).(uint64))
+		}
+		if !reflect.DeepEqual(fields, opts.wantFields) || !reflect.DeepEqual(values, opts.wantValues) || !reflect.DeepEqual(hits, opts.wantHits) {
+			t.Fatalf("unexpected facets\n got: %v %v %v\nwant: %v %v %v", fields, values, hits, opts.wantFields, opts.wantValues, opts.wantHits)
+		}
+	}
+
+	// facets are supported
+	o := opts{
+		facets:     true,
+		query:      `{"expr":"level:*","queryType":"facets"}`,
+		wantFields: []string{"level"},
+		wantValues: []string{"info"},
+		wantHits:   []uint64{2},
+	}
+	f(o)
+
+	// fallback skips const fields and fields with too many values
+	o = opts{
+		query:      `{"expr":"level:*","queryType":"facets","facets":{"maxValuesPerField":2}}`,
+		wantFields: []string{"level", "level"},
+		wantValues: []string{"info", "error"},
+		wantHits:   []uint64{2, 1},
+	}
+	f(o)
+
+	// fallback keeps const fields and limits values
+	o = opts{
+		query:      `{"expr":"level:*","queryType":"facets","facets":{"limit":1,"keepConstFields":true}}`,
+		wantFields: []string{"app", "level", "trace_id"},
+		wantValues: []string{"api", "info", "a"},
+		wantHits:   []uint64{3, 2, 1},
+	}
+	f(o)
+
+	// fallback requests only the query fields
+	o = opts{
+		query:      `{"expr":"level:*","queryType":"facets","fields":["level"]}`,
+		wantFields: []string{"level", "level"},
+		wantValues: []string{"info", "error"},
+		wantHits:   []uint64{2, 1},
+	}
+	f(o)
+}
+
+func TestVLAPIFacets(t *testing.T) {
+	type opts struct {
+		facets bool
+		want   FacetsResponse
+	}
+	f := func(opts opts) {
+		t.Helper()
+		srv := newFacetsServer(t, opts.facets)
+		defer srv.Close()
+
+		d := NewDatasource()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      srv.URL,
+				JSONData: []byte(`{"httpMethod":"GET"}`),
+			},
+		})
+		body := []byte(`{"query":"level:*","max_values_per_field":"2"}`)
+		req := httptest.NewRequest(http.MethodGet, facetsQueryPath, bytes.NewReader(body)).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		d.VLAPIFacets(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d; body: %s", rr.Code, rr.Body.String())
+		}
+
+		var got FacetsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("cannot unmarshal response: %s", err)
+		}
+		if !reflect.DeepEqual(got, opts.want) {
+			t.Fatalf("unexpected facets\n got: %+v\nwant: %+v", got, opts.want)
+		}
+	}
+
+	// request is proxied to VictoriaLogs
+	o := opts{
+		facets: true,
+		want: FacetsResponse{Facets: []Facet{
+			{FieldName: "level", Values: []FacetValue{{FieldValue: "info", Hits: 2}}},
+		}},
+	}
+	f(o)
+
+	// facets are built from field_names and field_values
+	o = opts{
+		want: FacetsResponse{Facets: []Facet{
+			{FieldName: "level", Values: []FacetValue{{FieldValue: "info", Hits: 2}, {FieldValue: "error", Hits: 1}}},
+		}},
+	}
+	f(o)
+}
+
+func TestFacetsFallbackSkippedFields(t *testing.T) {
+	const fieldsCount = maxFacetsFallbackFields + 3
+	var requested, inFlight, maxInFlight atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/facets", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("unsupported path requested: /select/logsql/facets"))
+	})
+	mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, _ *http.Request) {
+		var values []fieldHits
+		for i := 0; i < fieldsCount; i++ {
+			values = append(values, fieldHits{Value: fmt.Sprintf("field_%02d", i), Hits: uint64(fieldsCount - i)})
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]fieldHits{"values": values})
+	})
+	mux.HandleFunc("/select/logsql/field_values", func(w http.ResponseWriter, _ *http.Request) {
+		requested.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		// slow backend, so the requests overlap
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"values":[{"value":"a","hits":2},{"value":"b","hits":1}]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	d := NewDatasource()
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{"httpMethod":"GET"}`),
+		},
+	}
+	rsp, err := d.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: pluginCtx,
+		Queries: []backend.DataQuery{
+			{
+				RefID:     "A",
+				QueryType: string(QueryTypeFacets),
+				JSON:      []byte(`{"expr":"*","queryType":"facets"}`),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp := rsp.Responses["A"]
+	if resp.Error != nil {
+		t.Fatalf("unexpected response error: %s", resp.Error)
+	}
+	if n := requested.Load(); n != maxFacetsFallbackFields {
+		t.Fatalf("unexpected number of field_values requests %d; want %d", n, maxFacetsFallbackFields)
+	}
+	if n := maxInFlight.Load(); n < 2 || n > facetsFallbackConcurrency {
+		t.Fatalf("unexpected number of concurrent field_values requests %d; want from 2 to %d", n, facetsFallbackConcurrency)
+	}
+	frame := resp.Frames[0]
+	if frame.Rows() != 2*maxFacetsFallbackFields {
+		t.Fatalf("unexpected number of facet values %d; want %d", frame.Rows(), 2*maxFacetsFallbackFields)
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || !strings.Contains(frame.Meta.Notices[0].Text, "3 fields were skipped") {
+		t.Fatalf("expected the notice about skipped fields, got %+v", frame.Meta)
+	}
+
+	// the resource endpoint reports skipped fields in the response
+	ctx := backend.WithPluginContext(context.Background(), pluginCtx)
+	req := httptest.NewRequest(http.MethodGet, facetsQueryPath, bytes.NewReader([]byte(`{"query":"*"}`))).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	d.VLAPIFacets(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d; body: %s", rr.Code, rr.Body.String())
+	}
+	var got FacetsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cannot unmarshal response: %s", err)
+	}
+	if len(got.Facets) != maxFacetsFallbackFields || got.SkippedFields != 3 {
+		t.Fatalf("unexpected response: %d facets, %d skipped fields", len(got.Facets), got.SkippedFields)
+	}
+}
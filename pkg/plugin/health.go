@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	// healthCheckStart is the time window of the health check probes
+	healthCheckStart = "-5m"
+	// maxProbeBodySize limits the response body read by the probes
+	maxProbeBodySize = 1 << 20
+
+	tenantStatusFound       = "found"
+	tenantStatusNotFound    = "notFound"
+	tenantStatusUnavailable = "unavailable"
+)
+
+// healthDetails is returned in CheckHealthResult.JSONDetails
+type healthDetails struct {
+	Version string        `json:"version,omitempty"`
+	Build   string        `json:"build,omitempty"`
+	Tenant  healthTenant  `json:"tenant"`
+	Probes  []healthProbe `json:"probes"`
+	// LatencyMs is the round-trip latency of the logs query
+	LatencyMs int64 `json:"latencyMs"`
+	// Empty is true if there are no logs within the health check window
+	Empty bool `json:"empty"`
+}
+
+// healthTenant is the result of the configured tenant check against /select/tenant_ids
+type healthTenant struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// healthProbe is the result of a single request to VictoriaLogs
+type healthProbe struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// checkHealthWithInstance probes the VictoriaLogs endpoints used by the datasource,
+// checks the configured tenant and reports the VictoriaLogs version
+func checkHealthWithInstance(ctx context.Context, di *DatasourceInstance) (*backend.CheckHealthResult, error) {
+	base, err := url.Parse(strings.TrimRight(di.settings.URL, "/"))
+	if err != nil {
+		return newHealthCheckErrorf("failed to parse datasource URL: %s", err), nil
+	}
+
+	tenant := di.grafanaSettings.MultitenancyHeaders
+	details := healthDetails{
+		Tenant: healthTenant{ID: tenant.AccountID + ":" + tenant.ProjectID},
+	}
+
+	probe, body := di.healthProbe(ctx, base, "query", instantQueryPath, url.Values{
+		"query": {"*"},
+		"limit": {"1"},
+		"start": {healthCheckStart},
+	})
+	details.Probes = append(details.Probes, probe)
+	details.LatencyMs = probe.LatencyMs
+	if !probe.OK {
+		return newHealthCheckResult(backend.HealthStatusError, probe.Error, details), nil
+	}
+	details.Empty = len(bytes.TrimSpace(body)) == 0
+
+	for _, p := range []struct {
+		name string
+		path string
+		args url.Values
+	}{
+		{name: "field_names", path: fieldNamesPath, args: url.Values{"query": {"*"}, "start": {healthCheckStart}}},
+		{name: "hits", path: hitsQueryPath, args: url.Values{"query": {"*"}, "start": {healthCheckStart}, "step": {"1m"}}},
+	} {
+		probe, _ := di.healthProbe(ctx, base, p.name, p.path, p.args)
+		details.Probes = append(details.Probes, probe)
+	}
+
+	details.Tenant.Status = tenantStatusUnavailable
+	// the health check detects capabilities without the cache, so it reports the current VictoriaLogs version
+	if caps, err := di.refreshCapabilities(ctx); err == nil {
+		details.Version, details.Build = caps.Version, caps.Build
+		if caps.TenantIDs {
+			details.Tenant.Status = di.healthTenantStatus(ctx, base, details.Tenant.ID)
+		}
+	}
+
+	var msg string
+	switch {
+	case details.Empty && details.Tenant.Status == tenantStatusNotFound:
+		msg = fmt.Sprintf("Data source is working, but tenant %s has no logs. Check the tenant settings", details.Tenant.ID)
+	case details.Empty:
+		msg = "Data source is working, but there are no logs for the last 5 minutes"
+	default:
+		msg = "Data source is working"
+	}
+	if details.Version != "" {
+		msg += fmt.Sprintf(". VictoriaLogs %s, latency %dms", details.Version, details.LatencyMs)
+	} else {
+		msg += fmt.Sprintf(". Latency %dms", details.LatencyMs)
+	}
+
+	// logs can be queried, so failed field_names or hits probes only break some features
+	// like query builder suggestions or logs volume
+	var failed []string
+	for _, probe := range details.Probes {
+		if !probe.OK {
+			failed = append(failed, fmt.Sprintf("%s: %s", probe.Path, probe.Error))
+		}
+	}
+	if len(failed) > 0 {
+		msg += fmt.Sprintf(". Warning: VictoriaLogs endpoints used by the data source failed, check the proxy or the access settings: %s", strings.Join(failed, "; "))
+	}
+	return newHealthCheckResult(backend.HealthStatusOk, msg, details), nil
+}
+
+// newHealthCheckResult returns the health check result with the details
+func newHealthCheckResult(status backend.HealthStatus, msg string, details healthDetails) *backend.CheckHealthResult {
+	res := &backend.CheckHealthResult{Status: status, Message: msg}
+	b, err := json.Marshal(details)
+	if err != nil {
+		log.DefaultLogger.Error("check health: failed to marshal details", "err", err.Error())
+		return res
+	}
+	res.JSONDetails = b
+	return res
+}
+
+// healthProbe sends the request to the VictoriaLogs endpoint and returns the probe result with the response body
+func (di *DatasourceInstance) healthProbe(ctx context.Context, base *url.URL, name, endpoint string, args url.Values) (healthProbe, []byte) {
+	probe := healthProbe{Name: name, Path: endpoint}
+
+	method := di.grafanaSettings.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	start := time.Now()
+	status, body, err := di.probeRequest(ctx, base, method, endpoint, args, true)
+	probe.LatencyMs = time.Since(start).Milliseconds()
+	switch {
+	case err != nil:
+		probe.Error = err.Error()
+	case status != http.StatusOK:
+		probe.Error = fmt.Sprintf("got response code %d: %s", status, string(body))
+	default:
+		probe.OK = true
+	}
+	return probe, body
+}
+
+// healthTenantStatus checks whether the tenant is returned by /select/tenant_ids,
+// which lists tenants with logs
+func (di *DatasourceInstance) healthTenantStatus(ctx context.Context, base *url.URL, tenantID string) string {
+	// tenant headers are dropped the same way as in VLAPITenantIDs
+	status, body, err := di.probeRequest(ctx, base, http.MethodGet, tenantIDsPath, nil, false)
+	if err != nil || status != http.StatusOK {
+		return tenantStatusUnavailable
+	}
+	var tenants []struct {
+		AccountID any `json:"account_id"`
+		ProjectID any `json:"project_id"`
+	}
+	if err := json.Unmarshal(body, &tenants); err != nil {
+		return tenantStatusUnavailable
+	}
+	for _, t := range tenants {
+		if fmt.Sprint(t.AccountID)+":"+fmt.Sprint(t.ProjectID) == tenantID {
+			return tenantStatusFound
+		}
+	}
+	return tenantStatusNotFound
+}
+
+// probeRequest sends the request to check VictoriaLogs and returns the status code with the response body.
+// The args are merged with the query of the datasource URL and the custom query parameters,
+// so the probes are sent the same way as the queries.
+func (di *DatasourceInstance) probeRequest(ctx context.Context, base *url.URL, method, endpoint string, args url.Values, withTenant bool) (int, []byte, error) {
+	u := *base
+	u.Path = path.Join(u.Path, endpoint)
+	values := u.Query()
+	custom, err := url.ParseQuery(di.grafanaSettings.QueryParams)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse query params: %w", err)
+	}
+	for k, vl := range custom {
+		for _, v := range vl {
+			values.Add(k, v)
+		}
+	}
+	for k, vl := range args {
+		values[k] = vl
+	}
+	u.RawQuery = values.Encode()
+
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not create request: %w", err)
+	}
+	// CustomHeaders includes multitenancy headers (AccountID, ProjectID) and user-defined headers.
+	r.Header = di.grafanaSettings.CustomHeaders.Clone()
+	if !withTenant {
+		r.Header.Del(accountIDHeader)
+		r.Header.Del(projectIDHeader)
+	}
+
+	resp, err := di.httpClient.Do(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request error: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.DefaultLogger.Error("probe: failed to close response body", "err", err.Error())
+		}
+	}()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("got response code %d, failed to read body: %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestCheckHealth(t *testing.T) {
+	type opts struct {
+		logs        string
+		hitsStatus  int
+		queryStatus int
+		tenants     string
+		metrics     string
+		jsonData    string
+		urlQuery    string
+		// wantArgs must be sent with every probe
+		wantArgs url.Values
+
+		wantStatus       backend.HealthStatus
+		wantMessage      string
+		wantVersion      string
+		wantTenantStatus string
+		wantEmpty        bool
+	}
+	f := func(opts opts) {
+		t.Helper()
+		checkArgs := func(r *http.Request) {
+			for k, v := range opts.wantArgs {
+				if got := r.URL.Query()[k]; !reflect.DeepEqual(got, v) {
+					t.Errorf("unexpected %q arg of %s request; got %q; want %q", k, r.URL.Path, got, v)
+				}
+			}
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+			checkArgs(r)
+			if opts.queryStatus != 0 {
+				w.WriteHeader(opts.queryStatus)
+				_, _ = w.Write([]byte("cannot parse query"))
+				return
+			}
+			_, _ = w.Write([]byte(opts.logs))
+		})
+		mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, r *http.Request) {
+			checkArgs(r)
+			_, _ = w.Write([]byte(`{"values":[{"value":"_msg","hits":1}]}`))
+		})
+		mux.HandleFunc("/select/logsql/hits", func(w http.ResponseWriter, r *http.Request) {
+			checkArgs(r)
+			if opts.hitsStatus != 0 {
+				w.WriteHeader(opts.hitsStatus)
+				return
+			}
+			_, _ = w.Write([]byte(`{"hits":[]}`))
+		})
+		mux.HandleFunc("/select/tenant_ids", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(accountIDHeader) != "" {
+				t.Errorf("unexpected tenant header in tenant_ids request")
+			}
+			_, _ = w.Write([]byte(opts.tenants))
+		})
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			if opts.metrics == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(opts.metrics))
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		jsonData := opts.jsonData
+		if jsonData == "" {
+			jsonData = `{}`
+		}
+		d := NewDatasource()
+		res, err := d.CheckHealth(context.Background(), &backend.CheckHealthRequest{
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+					URL:      srv.URL + opts.urlQuery,
+					JSONData: []byte(jsonData),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if res.Status != opts.wantStatus {
+			t.Fatalf("unexpected status %v; want %v; message: %s", res.Status, opts.wantStatus, res.Message)
+		}
+		if !strings.Contains(res.Message, opts.wantMessage) {
+			t.Fatalf("unexpected message %q; want it to contain %q", res.Message, opts.wantMessage)
+		}
+
+		var details healthDetails
+		if err := json.Unmarshal(res.JSONDetails, &details); err != nil {
+			t.Fatalf("cannot unmarshal details: %s", err)
+		}
+		if details.Version != opts.wantVersion {
+			t.Fatalf("unexpected version %q; want %q", details.Version, opts.wantVersion)
+		}
+		if details.Tenant.Status != opts.wantTenantStatus {
+			t.Fatalf("unexpected tenant status %q; want %q", details.Tenant.Status, opts.wantTenantStatus)
+		}
+		if details.Empty != opts.wantEmpty {
+			t.Fatalf("unexpected empty %v; want %v", details.Empty, opts.wantEmpty)
+		}
+	}
+
+	metrics := `vm_app_version{version="victoria-logs-20250101-120000-tags-v1.38.0-0-gabcdef", short_version="v1.38.0"} 1
+vm_app_uptime_seconds 100
+`
+
+	// working datasource with logs
+	o := opts{
+		logs:             `{"_msg":"hello","_time":"2024-02-20T14:04:27Z"}`,
+		tenants:          `[{"account_id":0,"project_id":0}]`,
+		metrics:          metrics,
+		wantStatus:       backend.HealthStatusOk,
+		wantMessage:      "Data source is working. VictoriaLogs v1.38.0",
+		wantVersion:      "v1.38.0",
+		wantTenantStatus: tenantStatusFound,
+	}
+	f(o)
+
+	// empty datasource without /metrics and /select/tenant_ids
+	o = opts{
+		tenants:          `unsupported path requested: /select/tenant_ids`,
+		wantStatus:       backend.HealthStatusOk,
+		wantMessage:      "there are no logs for the last 5 minutes",
+		wantTenantStatus: tenantStatusUnavailable,
+		wantEmpty:        true,
+	}
+	f(o)
+
+	// tenant without logs
+	o = opts{
+		tenants:          `[{"account_id":"0","project_id":"0"}]`,
+		jsonData:         `{"multitenancyHeaders":{"AccountID":"12"}}`,
+		wantStatus:       backend.HealthStatusOk,
+		wantMessage:      "tenant 12:0 has no logs",
+		wantTenantStatus: tenantStatusNotFound,
+		wantEmpty:        true,
+	}
+	f(o)
+
+	// failed logs query
+	o = opts{
+		queryStatus: http.StatusBadRequest,
+		wantStatus:  backend.HealthStatusError,
+		wantMessage: "got response code 400: cannot parse query",
+	}
+	f(o)
+
+	// hits endpoint is blocked by the proxy
+	o = opts{
+		logs:             `{"_msg":"hello","_time":"2024-02-20T14:04:27Z"}`,
+		tenants:          `[{"account_id":0,"project_id":0}]`,
+		hitsStatus:       http.StatusForbidden,
+		wantStatus:       backend.HealthStatusOk,
+		wantMessage:      "Warning: VictoriaLogs endpoints used by the data source failed, check the proxy or the access settings: /select/logsql/hits: got response code 403",
+		wantTenantStatus: tenantStatusFound,
+	}
+	f(o)
+
+	// probes keep the datasource URL query and the custom query parameters
+	o = opts{
+		logs:             `{"_msg":"hello","_time":"2024-02-20T14:04:27Z"}`,
+		tenants:          `[{"account_id":0,"project_id":0}]`,
+		urlQuery:         "/?token=secret",
+		jsonData:         `{"customQueryParameters":"extra_filters=app:api"}`,
+		wantArgs:         url.Values{"token": {"secret"}, "extra_filters": {"app:api"}, "query": {"*"}},
+		wantStatus:       backend.HealthStatusOk,
+		wantMessage:      "Data source is working. Latency",
+		wantTenantStatus: tenantStatusFound,
+	}
+	f(o)
+}
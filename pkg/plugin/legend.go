@@ -0,0 +1,262 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var legendReplacer = regexp.MustCompile(`\{\{\s*(.+?)\s*\}\}`)
+
+// statsByClause matches the grouping labels of the stats pipe,
+// e.g. `| stats by (host, path) count()` or `| stats (host) count()`
+var statsByClause = regexp.MustCompile(`(?i)\|\s*stats\s+(?:by\s*)?\(([^)]*)\)`)
+
+// legendTemplate is a parsed legend format.
+//
+// Every `{{...}}` placeholder contains the label name followed by the pipe-separated
+// list of functions applied to the label value:
+//
+//	{{host | "unknown"}}                - the default value if the label is missing or empty
+//	{{host | upper}}, {{host | lower}}  - changes the case of the value
+//	{{path | truncate 20}}              - keeps the first 20 characters of the value
+//	{{path | replace "/api/(.+)" "$1"}} - replaces regex matches in the value
+type legendTemplate struct {
+	format       string
+	placeholders map[string]legendPlaceholder
+}
+
+type legendPlaceholder struct {
+	label string
+	funcs []func(string) string
+}
+
+// newLegendTemplate parses placeholders of the legend format.
+// Functions which can't be parsed are skipped.
+func newLegendTemplate(format string) *legendTemplate {
+	lt := &legendTemplate{
+		format:       format,
+		placeholders: make(map[string]legendPlaceholder),
+	}
+	for _, m := range legendReplacer.FindAllStringSubmatch(format, -1) {
+		if _, ok := lt.placeholders[m[0]]; ok {
+			continue
+		}
+		lt.placeholders[m[0]] = parseLegendPlaceholder(m[1])
+	}
+	return lt
+}
+
+// execute replaces placeholders of the legend format with the label values
+func (lt *legendTemplate) execute(labels data.Labels) string {
+	return legendReplacer.ReplaceAllStringFunc(lt.format, func(in string) string {
+		p := lt.placeholders[in]
+		value := labels[p.label]
+		for _, fn := range p.funcs {
+			value = fn(value)
+		}
+		return value
+	})
+}
+
+func parseLegendPlaceholder(s string) legendPlaceholder {
+	segments := splitLegendPipes(s)
+	p := legendPlaceholder{label: unquoteLegendToken(strings.TrimSpace(segments[0]))}
+	for _, segment := range segments[1:] {
+		fn, err := parseLegendFunc(tokenizeLegendFunc(segment))
+		if err != nil {
+			backend.Logger.Warn("skipping invalid legend function", "placeholder", s, "function", segment, "error", err)
+			continue
+		}
+		p.funcs = append(p.funcs, fn)
+	}
+	return p
+}
+
+func parseLegendFunc(tokens []string) (func(string) string, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty function")
+	}
+	name := tokens[0]
+	args := tokens[1:]
+	if isQuoted(name) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("default value can't have arguments")
+		}
+		defaultValue := unquoteLegendToken(name)
+		return func(v string) string {
+			if v == "" {
+				return defaultValue
+			}
+			return v
+		}, nil
+	}
+
+	switch name {
+	case "upper":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%q doesn't accept arguments", name)
+		}
+		return strings.ToUpper, nil
+	case "lower":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%q doesn't accept arguments", name)
+		}
+		return strings.ToLower, nil
+	case "truncate":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%q expects the max length argument", name)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid max length %q", args[0])
+		}
+		return func(v string) string {
+			if utf8.RuneCountInString(v) <= n {
+				return v
+			}
+			return string([]rune(v)[:n])
+		}, nil
+	case "replace":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%q expects regex and replacement arguments", name)
+		}
+		re, err := regexp.Compile(unquoteLegendToken(args[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		replacement := unquoteLegendToken(args[1])
+		return func(v string) string {
+			return re.ReplaceAllString(v, replacement)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+}
+
+// splitLegendPipes splits the placeholder by `|` outside of quoted strings
+func splitLegendPipes(s string) []string {
+	var segments []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '|':
+			segments = append(segments, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, s[start:])
+}
+
+// tokenizeLegendFunc splits the function call by whitespace outside of quoted strings.
+// Quoted tokens are returned with their quotes.
+func tokenizeLegendFunc(s string) []string {
+	var tokens []string
+	var quote rune
+	start := -1
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+			if start < 0 {
+				start = i
+			}
+		case c == ' ' || c == '\t':
+			if start >= 0 {
+				tokens = append(tokens, s[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+func isQuoted(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	switch s[0] {
+	case '"', '\'', '`':
+		return s[len(s)-1] == s[0]
+	default:
+		return false
+	}
+}
+
+func unquoteLegendToken(s string) string {
+	if !isQuoted(s) {
+		return s
+	}
+	if s[0] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	}
+	return s[1 : len(s)-1]
+}
+
+// autoLegend builds the legend from the stats result name
+// and the labels listed in the `by (...)` clause of the stats pipe
+func (q *Query) autoLegend(labels data.Labels) string {
+	var labelStrings []string
+	for _, label := range statsByLabels(q.Expr) {
+		if v, ok := labels[label]; ok {
+			labelStrings = append(labelStrings, fmt.Sprintf("%s=%q", label, v))
+		}
+	}
+
+	legend := labels[metricsName]
+	if len(labelStrings) > 0 {
+		legend += "{" + strings.Join(labelStrings, ",") + "}"
+	}
+	return legend
+}
+
+// statsByLabels returns label names from the `by (...)` clause of the last stats pipe in the expression.
+// Time buckets and offsets, e.g. `_time:1h offset 2h`, are dropped from the label names.
+func statsByLabels(expr string) []string {
+	matches := statsByClause.FindAllStringSubmatch(expr, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	var labels []string
+	for _, part := range strings.Split(matches[len(matches)-1][1], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if isQuoted(part) {
+			labels = append(labels, unquoteLegendToken(part))
+			continue
+		}
+		if i := strings.IndexAny(part, ": \t"); i >= 0 {
+			part = part[:i]
+		}
+		labels = append(labels, part)
+	}
+	return labels
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestQuery_parseLegend(t *testing.T) {
+	type opts struct {
+		expr         string
+		legendFormat string
+		labels       data.Labels
+		want         string
+	}
+	f := func(opts opts) {
+		t.Helper()
+		q := &Query{Expr: opts.expr, LegendFormat: opts.legendFormat}
+		got := q.parseLegend(opts.labels)
+		if got != opts.want {
+			t.Fatalf("parseLegend() = %q, want %q", got, opts.want)
+		}
+	}
+
+	labels := data.Labels{"__name__": "count(*)", "host": "web-1", "path": "/api/v1/users"}
+
+	// empty legend format uses all labels
+	o := opts{
+		expr:   "* | stats by (host, path) count()",
+		labels: labels,
+		want:   `count(*){host="web-1",path="/api/v1/users"}`,
+	}
+	f(o)
+
+	// plain label replacement
+	o = opts{
+		expr:         "*",
+		legendFormat: "{{ host }} {{missing}}",
+		labels:       labels,
+		want:         "web-1 ",
+	}
+	f(o)
+
+	// legend which resolves to empty string falls back to the expression
+	o = opts{
+		expr:         "*",
+		legendFormat: "{{missing}}",
+		labels:       labels,
+		want:         "*",
+	}
+	f(o)
+
+	// default value for missing label
+	o = opts{
+		expr:         "*",
+		legendFormat: `{{region | "unknown"}} {{host | "unknown"}}`,
+		labels:       labels,
+		want:         "unknown web-1",
+	}
+	f(o)
+
+	// default value with quoted pipe
+	o = opts{
+		expr:         "*",
+		legendFormat: `{{region | "a|b"}}`,
+		labels:       labels,
+		want:         "a|b",
+	}
+	f(o)
+
+	// upper and lower
+	o = opts{
+		expr:         "*",
+		legendFormat: `{{host | upper}} {{region | "EU" | lower}}`,
+		labels:       labels,
+		want:         "WEB-1 eu",
+	}
+	f(o)
+
+	// truncate
+	o = opts{
+		expr:         "*",
+		legendFormat: `{{path | truncate 7}}`,
+		labels:       labels,
+		want:         "/api/v1",
+	}
+	f(o)
+
+	// regex replace
+	o = opts{
+		expr:         "*",
+		legendFormat: `{{path | replace "^/api/v\\d+/(.+)$" "$1"}}`,
+		labels:       labels,
+		want:         "users",
+	}
+	f(o)
+
+	// invalid functions are skipped
+	o = opts{
+		expr:         "*",
+		legendFormat: `{{host | unknown | truncate x | replace "(" "" | upper}}`,
+		labels:       labels,
+		want:         "WEB-1",
+	}
+	f(o)
+
+	// auto legend uses labels from the by clause and the stats name
+	o = opts{
+		expr:         "* | stats by (path, host) count()",
+		legendFormat: legendFormatAuto,
+		labels:       labels,
+		want:         `count(*){path="/api/v1/users",host="web-1"}`,
+	}
+	f(o)
+
+	// auto legend ignores time buckets and labels missing in the series
+	o = opts{
+		expr:         `* | stats by (_time:1h offset 2h, "host", region) count()`,
+		legendFormat: legendFormatAuto,
+		labels:       labels,
+		want:         `count(*){host="web-1"}`,
+	}
+	f(o)
+
+	// auto legend without by clause
+	o = opts{
+		expr:         "* | stats count()",
+		legendFormat: legendFormatAuto,
+		labels:       data.Labels{"__name__": "count(*)"},
+		want:         "count(*)",
+	}
+	f(o)
+
+	// auto legend falls back to the expression
+	o = opts{
+		expr:         "* | stats count()",
+		legendFormat: legendFormatAuto,
+		labels:       data.Labels{},
+		want:         "* | stats count()",
+	}
+	f(o)
+}
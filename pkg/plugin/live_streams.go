@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	// defaultMaxLiveStreams is the default max number of concurrent live streams of the datasource instance
+	defaultMaxLiveStreams = 100
+	// defaultMaxLiveStreamsPerUser is the default max number of concurrent live streams of a single user
+	defaultMaxLiveStreamsPerUser = 10
+)
+
+// liveStreams counts live streams of the datasource instance
+// and limits their number per instance and per user.
+// A live stream is a channel, which is reserved by SubscribeStream for every subscribed user
+// and released when RunStream of the channel returns, since Grafana doesn't report
+// when a single subscriber leaves.
+type liveStreams struct {
+	maxStreams        int
+	maxStreamsPerUser int
+
+	mu       sync.Mutex
+	total    int
+	perUser  map[string]int
+	channels map[string]*liveChannel
+}
+
+// liveChannel is a live stream channel with the users subscribed to it
+type liveChannel struct {
+	path    string
+	users   map[string]struct{}
+	running bool
+}
+
+func newLiveStreams(maxStreams, maxStreamsPerUser int) *liveStreams {
+	return &liveStreams{
+		maxStreams:        maxStreams,
+		maxStreamsPerUser: maxStreamsPerUser,
+		perUser:           make(map[string]int),
+		channels:          make(map[string]*liveChannel),
+	}
+}
+
+// subscribe reserves the channel for the user if the limits allow it.
+// The first subscription of the channel counts against the instance limit,
+// every user subscribed to the channel counts against the per user limit.
+// The reservation is released by stop when RunStream of the channel returns.
+func (ls *liveStreams) subscribe(path, user string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	c := ls.channels[path]
+	if c == nil {
+		if err := ls.checkLocked(user, true); err != nil {
+			return err
+		}
+		c = ls.newChannelLocked(path)
+	}
+	return ls.addUserLocked(c, user)
+}
+
+// start returns the channel reserved by subscribe for RunStream.
+// If the channel is already run by another RunStream, e.g. after a re-subscribe,
+// or the reservation is missing, a new one is made for the user if the limits allow it.
+// stop must be called when RunStream returns.
+func (ls *liveStreams) start(path, user string) (*liveChannel, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if c := ls.channels[path]; c != nil && !c.running {
+		c.running = true
+		return c, nil
+	}
+	if err := ls.checkLocked(user, true); err != nil {
+		return nil, err
+	}
+	c := ls.newChannelLocked(path)
+	c.running = true
+	if err := ls.addUserLocked(c, user); err != nil {
+		ls.stopLocked(c)
+		return nil, err
+	}
+	return c, nil
+}
+
+// stop releases the channel for all its users
+func (ls *liveStreams) stop(c *liveChannel) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.stopLocked(c)
+}
+
+func (ls *liveStreams) stopLocked(c *liveChannel) {
+	ls.total--
+	for user := range c.users {
+		ls.perUser[user]--
+		if ls.perUser[user] <= 0 {
+			delete(ls.perUser, user)
+		}
+	}
+	if ls.channels[c.path] == c {
+		delete(ls.channels, c.path)
+	}
+}
+
+func (ls *liveStreams) newChannelLocked(path string) *liveChannel {
+	c := &liveChannel{path: path, users: make(map[string]struct{})}
+	ls.channels[path] = c
+	ls.total++
+	return c
+}
+
+// addUserLocked counts the channel for the user, users subscribed again aren't counted twice
+func (ls *liveStreams) addUserLocked(c *liveChannel, user string) error {
+	if _, ok := c.users[user]; ok {
+		return nil
+	}
+	if err := ls.checkLocked(user, false); err != nil {
+		return err
+	}
+	c.users[user] = struct{}{}
+	ls.perUser[user]++
+	return nil
+}
+
+// checkLocked returns an error if the user can't subscribe to one more channel.
+// The instance limit is checked only for new channels.
+func (ls *liveStreams) checkLocked(user string, newChannel bool) error {
+	if newChannel && ls.total >= ls.maxStreams {
+		return fmt.Errorf("too many concurrent live streams for the datasource; limit: %d", ls.maxStreams)
+	}
+	if ls.perUser[user] >= ls.maxStreamsPerUser {
+		return fmt.Errorf("too many concurrent live streams for the user %q; limit: %d", user, ls.maxStreamsPerUser)
+	}
+	return nil
+}
+
+// liveStreamUser returns the login of the Grafana user who started the live stream
+func liveStreamUser(pCtx backend.PluginContext) string {
+	if pCtx.User == nil {
+		return ""
+	}
+	return pCtx.User.Login
+}
+
+// validateLiveQuery checks that the live stream can be started for the query
+// by building the request URL the same way streamQuery does
+func (di *DatasourceInstance) validateLiveQuery(q *Query) error {
+	if strings.TrimSpace(q.Expr) == "" {
+		return fmt.Errorf("query expression can't be blank")
+	}
+	if q.isLiveStats() {
+		window, err := q.liveWindow()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		q.TimeRange = backend.TimeRange{From: now.Add(-window), To: now}
+		if _, err := q.getQueryURL(di.settings.URL, di.grafanaSettings.QueryParams); err != nil {
+			return fmt.Errorf("failed to create request URL: %w", err)
+		}
+		return nil
+	}
+	if _, err := q.queryTailURL(di.settings.URL, di.grafanaSettings.QueryParams); err != nil {
+		return fmt.Errorf("failed to create request URL: %w", err)
+	}
+	return nil
+}
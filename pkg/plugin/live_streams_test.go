@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestLiveStreams(t *testing.T) {
+	ls := newLiveStreams(3, 2)
+	f := func(path, user string, wantErr bool) {
+		t.Helper()
+		err := ls.subscribe(path, user)
+		if (err != nil) != wantErr {
+			t.Fatalf("subscribe(%q, %q) error = %v, wantErr %v", path, user, err, wantErr)
+		}
+	}
+
+	f("a", "alice", false)
+	f("b", "alice", false)
+	// the same user subscribed again isn't counted twice
+	f("b", "alice", false)
+	// per user limit
+	f("c", "alice", true)
+	f("c", "bob", false)
+	// per instance limit
+	f("d", "carol", true)
+	// users joining a channel count against their own limit, but not against the instance limit
+	f("a", "bob", false)
+	f("b", "bob", true)
+
+	a, err := ls.start("a", "alice")
+	if err != nil {
+		t.Fatalf("unexpected start error: %s", err)
+	}
+	// the stopped channel frees the slots of all its users
+	ls.stop(a)
+	f("d", "carol", false)
+	f("b", "bob", false)
+	f("e", "alice", true)
+
+	// a channel without a reservation is reserved by start within the limits
+	if _, err := ls.start("f", "dave"); err == nil {
+		t.Fatalf("expected the instance limit error")
+	}
+
+	// a channel run again after a re-subscribe gets its own reservation,
+	// so the first run doesn't release it
+	ls = newLiveStreams(3, 2)
+	f("a", "alice", false)
+	first, err := ls.start("a", "alice")
+	if err != nil {
+		t.Fatalf("unexpected start error: %s", err)
+	}
+	f("a", "alice", false)
+	second, err := ls.start("a", "alice")
+	if err != nil {
+		t.Fatalf("unexpected start error: %s", err)
+	}
+	ls.stop(first)
+	if ls.total != 1 || ls.perUser["alice"] != 1 || ls.channels["a"] != second {
+		t.Fatalf("unexpected reservations after the first run: total %d, per user %v", ls.total, ls.perUser)
+	}
+	ls.stop(second)
+	if ls.total != 0 || len(ls.perUser) != 0 || len(ls.channels) != 0 {
+		t.Fatalf("expected stopped channels to be forgotten, got total %d, per user %v, channels %v", ls.total, ls.perUser, ls.channels)
+	}
+}
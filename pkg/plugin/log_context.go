@@ -0,0 +1,262 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
+)
+
+const (
+	// defaultLogContextLimit is the number of lines returned before and after the row by default
+	defaultLogContextLimit = 50
+	// maxLogContextLimit limits the number of lines returned before and after the row
+	maxLogContextLimit = 1000
+	// maxLogContextTies limits the number of lines with the same timestamp as the row
+	maxLogContextTies = 1000
+	// logContextWindow is the time window searched for lines before and after the row
+	logContextWindow = 2 * time.Hour
+)
+
+// logContextRequest describes the row which surrounding lines are requested
+type logContextRequest struct {
+	// Time is the row `_time` in RFC3339 format with nanoseconds
+	Time string `json:"time"`
+	// StreamID is the row `_stream_id`, Stream labels are used if it is empty
+	StreamID string            `json:"streamId"`
+	Stream   map[string]string `json:"stream"`
+	// ID is the row id returned in the logs frame, it identifies the row among lines with the same timestamp
+	ID string `json:"id"`
+	// Limit is the number of lines before and after the row
+	Limit int `json:"limit"`
+}
+
+// logContextResponse contains the lines before the row, the row itself marked as anchor
+// and the lines after the row sorted by time. Lines with the same time are sorted by stream id and id.
+type logContextResponse struct {
+	Rows []logContextRow `json:"rows"`
+}
+
+type logContextRow struct {
+	Time string `json:"time"`
+	// TimeNs is the unix timestamp in nanoseconds, it is a string since JSON numbers lose the precision
+	TimeNs   string            `json:"timeNs"`
+	Line     string            `json:"line"`
+	ID       string            `json:"id"`
+	Labels   json.RawMessage   `json:"labels"`
+	StreamID string            `json:"streamId,omitempty"`
+	Stream   map[string]string `json:"stream,omitempty"`
+	Anchor   bool              `json:"anchor,omitempty"`
+}
+
+// LogContext returns lines before and after the given log row.
+// The lines are split exactly at the row timestamp, so lines with the same timestamp aren't duplicated or lost.
+func (d *Datasource) LogContext(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	pluginCxt := backend.PluginConfigFromContext(ctx)
+	defer func() {
+		if err := req.Body.Close(); err != nil {
+			d.logger.Error("LogContext: failed to close request body", "err", err.Error())
+		}
+	}()
+
+	di, err := d.getInstance(ctx, pluginCxt)
+	if err != nil {
+		d.logger.Error("Error loading datasource", "error", err)
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	ctx, cancel := di.requestContext(ctx)
+	defer cancel()
+
+	var lcr logContextRequest
+	if err := json.NewDecoder(req.Body).Decode(&lcr); err != nil {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("failed to parse log context request: %w", err))
+		return
+	}
+	rows, err := di.logContext(ctx, &lcr)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	b, err := json.Marshal(logContextResponse{Rows: rows})
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write(b); err != nil {
+		d.logger.Warn("Error writing response", "error", err)
+	}
+}
+
+// logContext queries lines before, at and after the row timestamp
+// and splits lines with the same timestamp at the row
+func (di *DatasourceInstance) logContext(ctx context.Context, lcr *logContextRequest) ([]logContextRow, error) {
+	nsecs, ok := utils.TryParseTimestampRFC3339Nano(lcr.Time)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse log row time %q: RFC3339 format is expected", lcr.Time)
+	}
+	anchor := time.Unix(0, nsecs).UTC()
+	ts := anchor.Format(time.RFC3339Nano)
+
+	scope, err := logContextScope(lcr)
+	if err != nil {
+		return nil, err
+	}
+	limit := lcr.Limit
+	if limit <= 0 {
+		limit = defaultLogContextLimit
+	}
+	if limit > maxLogContextLimit {
+		limit = maxLogContextLimit
+	}
+
+	// range params are truncated to seconds, so they are widened by a second,
+	// the exact boundary is set by the _time filter
+	before, err := di.logContextRows(ctx, fmt.Sprintf("%s _time:<%s | sort by (_time desc) limit %d", scope, ts, limit), limit,
+		anchor.Add(-logContextWindow), anchor.Add(time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lines before the row: %w", err)
+	}
+	ties, err := di.logContextRows(ctx, fmt.Sprintf("%s _time:[%s, %s]", scope, ts, ts), maxLogContextTies,
+		anchor, anchor.Add(time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lines at the row time: %w", err)
+	}
+	after, err := di.logContextRows(ctx, fmt.Sprintf("%s _time:>%s | sort by (_time) limit %d", scope, ts, limit), limit,
+		anchor, anchor.Add(logContextWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lines after the row: %w", err)
+	}
+	return splitLogContext(before, ties, after, lcr.ID, limit), nil
+}
+
+// splitLogContext returns up to limit lines before and after the anchor row with the given id.
+// Lines with the anchor timestamp are placed before or after it according to the stable order.
+// All of them are placed before the split if the anchor row isn't found.
+func splitLogContext(before, ties, after []logRow, id string, limit int) []logContextRow {
+	sortLogRows(before)
+	sortLogRows(ties)
+	sortLogRows(after)
+
+	anchorIdx := len(ties)
+	for i, r := range ties {
+		if r.ID == id {
+			anchorIdx = i
+			break
+		}
+	}
+
+	before = append(before, ties[:anchorIdx]...)
+	if len(before) > limit {
+		before = before[len(before)-limit:]
+	}
+	var anchor []logRow
+	if anchorIdx < len(ties) {
+		anchor = ties[anchorIdx : anchorIdx+1]
+		after = append(ties[anchorIdx+1:len(ties):len(ties)], after...)
+	}
+	if len(after) > limit {
+		after = after[:limit]
+	}
+
+	rows := make([]logContextRow, 0, len(before)+len(anchor)+len(after))
+	for _, r := range before {
+		rows = append(rows, newLogContextRow(r, false))
+	}
+	for _, r := range anchor {
+		rows = append(rows, newLogContextRow(r, true))
+	}
+	for _, r := range after {
+		rows = append(rows, newLogContextRow(r, false))
+	}
+	return rows
+}
+
+// sortLogRows sorts rows by time, lines with the same time are sorted by stream id and id
+func sortLogRows(rows []logRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.StreamID != b.StreamID {
+			return a.StreamID < b.StreamID
+		}
+		return a.ID < b.ID
+	})
+}
+
+func newLogContextRow(r logRow, anchor bool) logContextRow {
+	return logContextRow{
+		Time:     r.Time.Format(time.RFC3339Nano),
+		TimeNs:   strconv.FormatInt(r.Time.UnixNano(), 10),
+		Line:     r.Line,
+		ID:       r.ID,
+		Labels:   r.Labels,
+		StreamID: r.StreamID,
+		Stream:   r.Stream,
+		Anchor:   anchor,
+	}
+}
+
+// logContextScope returns the filter of the row stream by the stream id or by the stream labels
+func logContextScope(lcr *logContextRequest) (string, error) {
+	if lcr.StreamID != "" {
+		return fmt.Sprintf("%s:%s", streamIdField, strconv.Quote(lcr.StreamID)), nil
+	}
+	if len(lcr.Stream) == 0 {
+		return "", fmt.Errorf("either stream id or stream labels must be set")
+	}
+	names := make([]string, 0, len(lcr.Stream))
+	for name := range lcr.Stream {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	labels := make([]string, len(names))
+	for i, name := range names {
+		labels[i] = fmt.Sprintf("%s=%s", strconv.Quote(name), strconv.Quote(lcr.Stream[name]))
+	}
+	return fmt.Sprintf("%s:{%s}", streamField, strings.Join(labels, ",")), nil
+}
+
+// logContextRows returns log rows matching the expression within the time range
+func (di *DatasourceInstance) logContextRows(ctx context.Context, expr string, limit int, from, to time.Time) ([]logRow, error) {
+	q := &Query{
+		DataQuery: backend.DataQuery{
+			TimeRange: backend.TimeRange{From: from, To: to},
+		},
+		Expr:      expr,
+		MaxLines:  limit,
+		QueryType: QueryTypeInstant,
+	}
+	r, err := di.datasourceQuery(ctx, q, false)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, nil
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			backend.Logger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	var rows []logRow
+	err = readLogRows(r, func(row logRow) {
+		rows = append(rows, row)
+	})
+	return rows, err
+}
@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestLogContext(t *testing.T) {
+	type opts struct {
+		request string
+		before  string
+		ties    string
+		after   string
+
+		wantScope  string
+		wantLines  []string
+		wantAnchor string
+		wantErr    bool
+	}
+	f := func(opts opts) {
+		t.Helper()
+		var scopes []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query().Get("query")
+			i := strings.Index(query, " _time:")
+			if i < 0 {
+				t.Errorf("unexpected query without _time filter: %q", query)
+				return
+			}
+			scopes = append(scopes, query[:i])
+			switch filter := query[i+len(" _time:"):]; {
+			case strings.HasPrefix(filter, "<2024-01-01T10:00:00.000000005Z |"):
+				_, _ = w.Write([]byte(opts.before))
+			case filter == "[2024-01-01T10:00:00.000000005Z, 2024-01-01T10:00:00.000000005Z]":
+				_, _ = w.Write([]byte(opts.ties))
+			case strings.HasPrefix(filter, ">2024-01-01T10:00:00.000000005Z |"):
+				_, _ = w.Write([]byte(opts.after))
+			default:
+				t.Errorf("unexpected _time filter: %q", filter)
+			}
+		}))
+		defer srv.Close()
+
+		d := NewDatasource()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      srv.URL,
+				JSONData: []byte(`{"httpMethod":"GET"}`),
+			},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/log_context", bytes.NewReader([]byte(opts.request))).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		d.LogContext(rr, req)
+		if opts.wantErr {
+			if rr.Code == http.StatusOK {
+				t.Fatalf("expected error; got response: %s", rr.Body.String())
+			}
+			return
+		}
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d; body: %s", rr.Code, rr.Body.String())
+		}
+		for _, scope := range scopes {
+			if scope != opts.wantScope {
+				t.Fatalf("unexpected scope %q; want %q", scope, opts.wantScope)
+			}
+		}
+
+		var resp logContextResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot unmarshal response: %s", err)
+		}
+		var lines []string
+		var anchor string
+		for _, row := range resp.Rows {
+			lines = append(lines, row.Line)
+			if row.Anchor {
+				if anchor != "" {
+					t.Fatalf("expected a single anchor row")
+				}
+				anchor = row.Line
+			}
+		}
+		if !reflect.DeepEqual(lines, opts.wantLines) {
+			t.Fatalf("unexpected lines\n got: %q\nwant: %q", lines, opts.wantLines)
+		}
+		if anchor != opts.wantAnchor {
+			t.Fatalf("unexpected anchor %q; want %q", anchor, opts.wantAnchor)
+		}
+	}
+
+	row := func(ts, msg string) string {
+		return `{"_time":"` + ts + `","_msg":"` + msg + `","_stream_id":"s1","_stream":"{app=\"api\"}"}` + "\n"
+	}
+	rowID := func(ts, msg string) string {
+		return buildLogID([]byte(ts), []byte(msg), []byte("s1"))
+	}
+	const anchorTime = "2024-01-01T10:00:00.000000005Z"
+	before := row("2024-01-01T10:00:00.000000004Z", "b2") + row("2024-01-01T10:00:00.000000003Z", "b1")
+	after := row("2024-01-01T10:00:00.000000006Z", "a1") + row("2024-01-01T10:00:00.000000007Z", "a2")
+	// ties are returned by VictoriaLogs in arbitrary order and sorted by id
+	ties := []string{"t1", "t2", "t3"}
+	sortedTies := append([]string(nil), ties...)
+	sort.Slice(sortedTies, func(i, j int) bool {
+		return rowID(anchorTime, sortedTies[i]) < rowID(anchorTime, sortedTies[j])
+	})
+	tiesResponse := row(anchorTime, "t3") + row(anchorTime, "t1") + row(anchorTime, "t2")
+
+	// ties before the anchor go before it, ties after the anchor go after it
+	o := opts{
+		request:    `{"time":"` + anchorTime + `","streamId":"s1","id":"` + rowID(anchorTime, sortedTies[1]) + `"}`,
+		before:     before,
+		ties:       tiesResponse,
+		after:      after,
+		wantScope:  `_stream_id:"s1"`,
+		wantLines:  []string{"b1", "b2", sortedTies[0], sortedTies[1], sortedTies[2], "a1", "a2"},
+		wantAnchor: sortedTies[1],
+	}
+	f(o)
+
+	// limit is applied on both sides of the anchor
+	o = opts{
+		request:    `{"time":"` + anchorTime + `","streamId":"s1","id":"` + rowID(anchorTime, sortedTies[1]) + `","limit":1}`,
+		before:     before,
+		ties:       tiesResponse,
+		after:      after,
+		wantScope:  `_stream_id:"s1"`,
+		wantLines:  []string{sortedTies[0], sortedTies[1], sortedTies[2]},
+		wantAnchor: sortedTies[1],
+	}
+	f(o)
+
+	// unknown anchor, ties are placed before the split
+	o = opts{
+		request:   `{"time":"` + anchorTime + `","stream":{"app":"api","pod name":"a\"b"},"id":"unknown"}`,
+		before:    before,
+		ties:      tiesResponse,
+		after:     after,
+		wantScope: `_stream:{"app"="api","pod name"="a\"b"}`,
+		wantLines: []string{"b1", "b2", sortedTies[0], sortedTies[1], sortedTies[2], "a1", "a2"},
+	}
+	f(o)
+
+	// no surrounding lines
+	o = opts{
+		request:    `{"time":"` + anchorTime + `","streamId":"s1","id":"` + rowID(anchorTime, "t1") + `"}`,
+		ties:       row(anchorTime, "t1"),
+		wantScope:  `_stream_id:"s1"`,
+		wantLines:  []string{"t1"},
+		wantAnchor: "t1",
+	}
+	f(o)
+
+	// unbounded context is rejected
+	o = opts{
+		request: `{"time":"` + anchorTime + `","id":"x"}`,
+		wantErr: true,
+	}
+	f(o)
+
+	// invalid time
+	o = opts{
+		request: `{"time":"yesterday","streamId":"s1"}`,
+		wantErr: true,
+	}
+	f(o)
+}
@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// proxyPathPrefix is the only prefix of VictoriaLogs endpoints which can be proxied via the resource calls
+const proxyPathPrefix = "/select/logsql/"
+
+// fieldsQueryParams are the args of the endpoints returning field names and values,
+// see https://docs.victoriametrics.com/victorialogs/querying/#querying-field-values
+var fieldsQueryParams = []string{
+	"query", "limit", "start", "end", "field", "filter", "ignore_pipes",
+	"extra_filters", "extra_stream_filters",
+}
+
+// defaultProxyEndpoints are the VictoriaLogs endpoints used by the query editor and their allowed args
+var defaultProxyEndpoints = []ProxyEndpoint{
+	{Path: "/select/logsql/field_values", Params: fieldsQueryParams},
+	{Path: "/select/logsql/field_names", Params: fieldsQueryParams},
+	{Path: "/select/logsql/streams", Params: fieldsQueryParams},
+	{Path: "/select/logsql/stream_field_names", Params: fieldsQueryParams},
+	{Path: "/select/logsql/stream_field_values", Params: fieldsQueryParams},
+	{Path: facetsQueryPath, Params: append([]string{"max_values_per_field", "max_value_len", "keep_const_fields"}, fieldsQueryParams...)},
+}
+
+// proxyParamRe matches names of the proxied args
+var proxyParamRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// errProxyEndpointNotAllowed is returned for endpoints missing in the allowlist
+var errProxyEndpointNotAllowed = errors.New("endpoint is not allowed")
+
+// ProxyEndpoint is a VictoriaLogs endpoint which can be requested via the resource calls
+type ProxyEndpoint struct {
+	// Path is the endpoint path, it must start with /select/logsql/
+	Path string `json:"path"`
+	// Params are the args forwarded to the endpoint, other args are dropped
+	Params []string `json:"params"`
+}
+
+// proxyAllowlist contains allowed args per proxied endpoint path
+// and the custom query parameters added to every proxied request
+type proxyAllowlist struct {
+	endpoints map[string]map[string]struct{}
+	custom    url.Values
+}
+
+// newProxyAllowlist merges the configured endpoints with the default ones.
+// Args of the custom query parameters setting are added to requests of every endpoint.
+func newProxyAllowlist(endpoints []ProxyEndpoint, customQueryParams string) (*proxyAllowlist, error) {
+	custom, err := url.ParseQuery(customQueryParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse custom query params: %w", err)
+	}
+
+	al := &proxyAllowlist{endpoints: make(map[string]map[string]struct{}), custom: custom}
+	add := func(e ProxyEndpoint) error {
+		if !strings.HasPrefix(e.Path, proxyPathPrefix) || len(e.Path) == len(proxyPathPrefix) ||
+			path.Clean(e.Path) != e.Path || strings.ContainsAny(e.Path, "?#") {
+			return fmt.Errorf("invalid proxy endpoint path %q: it must be a clean path under %s", e.Path, proxyPathPrefix)
+		}
+		params, ok := al.endpoints[e.Path]
+		if !ok {
+			params = make(map[string]struct{})
+			al.endpoints[e.Path] = params
+		}
+		for _, p := range e.Params {
+			if !proxyParamRe.MatchString(p) {
+				return fmt.Errorf("invalid param %q of proxy endpoint %q", p, e.Path)
+			}
+			params[p] = struct{}{}
+		}
+		return nil
+	}
+	for _, e := range defaultProxyEndpoints {
+		if err := add(e); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range endpoints {
+		if err := add(e); err != nil {
+			return nil, err
+		}
+	}
+	return al, nil
+}
+
+// params returns the args of the request to the endpoint from the JSON object in the body
+// merged with the custom query parameters. Args which aren't allowed for the endpoint are dropped.
+// It returns errProxyEndpointNotAllowed if the endpoint isn't in the allowlist.
+func (al *proxyAllowlist) params(endpoint string, body io.Reader) (url.Values, error) {
+	allowed, ok := al.endpoints[endpoint]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errProxyEndpointNotAllowed, endpoint)
+	}
+
+	var raw map[string]any
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse query json: %s", err)
+	}
+	params := url.Values{}
+	for k, vs := range al.custom {
+		params[k] = append([]string(nil), vs...)
+	}
+	var dropped []string
+	for k, v := range raw {
+		values, err := proxyParamValues(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of param %q: %w", k, err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if _, ok := allowed[k]; !ok {
+			dropped = append(dropped, k)
+			continue
+		}
+		params[k] = values
+	}
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		backend.Logger.Debug("proxy: dropped args which are not allowed for the endpoint", "endpoint", endpoint, "args", strings.Join(dropped, ","))
+	}
+	return params, nil
+}
+
+// proxyParamValues converts the JSON value of the arg into non-empty arg values
+func proxyParamValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []any:
+		var values []string
+		for _, item := range v {
+			vs, err := proxyParamValues(item)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := item.([]any); ok {
+				return nil, fmt.Errorf("nested arrays are not supported")
+			}
+			values = append(values, vs...)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
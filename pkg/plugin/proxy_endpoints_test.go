@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestNewProxyAllowlist(t *testing.T) {
+	f := func(endpoints []ProxyEndpoint, customQueryParams string, wantErr bool) {
+		t.Helper()
+		_, err := newProxyAllowlist(endpoints, customQueryParams)
+		if (err != nil) != wantErr {
+			t.Fatalf("unexpected error: %v; wantErr %v", err, wantErr)
+		}
+	}
+
+	// default endpoints
+	f(nil, "", false)
+
+	// new endpoint and args of the default one
+	f([]ProxyEndpoint{
+		{Path: "/select/logsql/stream_ids", Params: []string{"query", "start", "end"}},
+		{Path: "/select/logsql/field_values", Params: []string{"offset"}},
+	}, "", false)
+
+	// endpoint outside /select/logsql/
+	f([]ProxyEndpoint{{Path: "/internal/force_merge"}}, "", true)
+	f([]ProxyEndpoint{{Path: "/select/logsql/"}}, "", true)
+	f([]ProxyEndpoint{{Path: "/select/logsql/../../metrics"}}, "", true)
+	f([]ProxyEndpoint{{Path: "/select/logsql/query?limit=1"}}, "", true)
+
+	// invalid param
+	f([]ProxyEndpoint{{Path: "/select/logsql/stream_ids", Params: []string{"query&limit"}}}, "", true)
+
+	// invalid custom query params
+	f(nil, "a=%zz", true)
+}
+
+func TestProxyAllowlist_params(t *testing.T) {
+	type opts struct {
+		endpoints         []ProxyEndpoint
+		customQueryParams string
+		endpoint          string
+		body              string
+		want              string
+		wantErr           string
+	}
+	f := func(opts opts) {
+		t.Helper()
+		al, err := newProxyAllowlist(opts.endpoints, opts.customQueryParams)
+		if err != nil {
+			t.Fatalf("unexpected allowlist error: %s", err)
+		}
+		params, err := al.params(opts.endpoint, strings.NewReader(opts.body))
+		if opts.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), opts.wantErr) {
+				t.Fatalf("unexpected error %v; want it to contain %q", err, opts.wantErr)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := params.Encode(); got != opts.want {
+			t.Fatalf("unexpected params %q; want %q", got, opts.want)
+		}
+	}
+
+	// default endpoint skips empty args
+	o := opts{
+		endpoint: "/select/logsql/field_values",
+		body:     `{"query":"*","field":"level","limit":"10","filter":"","extra_filters":null}`,
+		want:     "field=level&limit=10&query=%2A",
+	}
+	f(o)
+
+	// numbers, bools and arrays
+	o = opts{
+		endpoints: []ProxyEndpoint{{Path: "/select/logsql/stream_ids", Params: []string{"query", "limit", "field", "ignore_pipes"}}},
+		endpoint:  "/select/logsql/stream_ids",
+		body:      `{"query":"*","limit":10,"ignore_pipes":true,"field":["a","b"]}`,
+		want:      "field=a&field=b&ignore_pipes=true&limit=10&query=%2A",
+	}
+	f(o)
+
+	// configured args extend the default endpoint
+	o = opts{
+		endpoints: []ProxyEndpoint{{Path: "/select/logsql/field_values", Params: []string{"offset"}}},
+		endpoint:  "/select/logsql/field_values",
+		body:      `{"field":"level","offset":"5"}`,
+		want:      "field=level&offset=5",
+	}
+	f(o)
+
+	// custom query params are added to every endpoint and can't be changed by the request
+	o = opts{
+		customQueryParams: "timeout=10s",
+		endpoint:          "/select/logsql/field_names",
+		body:              `{"query":"*","timeout":"20s"}`,
+		want:              "query=%2A&timeout=10s",
+	}
+	f(o)
+
+	// not allowed args are dropped
+	o = opts{
+		endpoint: "/select/logsql/field_names",
+		body:     `{"query":"*","offset":"5","step":"1m"}`,
+		want:     "query=%2A",
+	}
+	f(o)
+
+	// unsupported value
+	o = opts{
+		endpoint: "/select/logsql/field_names",
+		body:     `{"query":{"a":"b"}}`,
+		wantErr:  `invalid value of param "query"`,
+	}
+	f(o)
+
+	// not allowed endpoint
+	o = opts{
+		endpoint: "/select/logsql/query",
+		body:     `{"query":"*"}`,
+		wantErr:  "endpoint is not allowed: /select/logsql/query",
+	}
+	f(o)
+}
+
+func TestVLAPIQuery_ProxyEndpoints(t *testing.T) {
+	type opts struct {
+		path              string
+		body              string
+		urlQuery          string
+		customQueryParams string
+		wantErr           bool
+		wantQuery         string
+	}
+	f := func(opts opts) {
+		t.Helper()
+		var gotQuery string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotQuery = r.URL.RawQuery
+			_, _ = w.Write([]byte(`{"values":[]}`))
+		}))
+		defer srv.Close()
+
+		ds := NewDatasource()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				URL:      srv.URL + opts.urlQuery,
+				JSONData: []byte(fmt.Sprintf(`{"proxyEndpoints":[{"path":"/select/logsql/stream_ids","params":["query","offset"]}],"customQueryParameters":%q}`, opts.customQueryParams)),
+			},
+		})
+		req := httptest.NewRequest(http.MethodPost, opts.path, bytes.NewReader([]byte(opts.body))).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		ds.VLAPIQuery(rr, req)
+		if (rr.Code != http.StatusOK) != opts.wantErr {
+			t.Fatalf("unexpected status %d; wantErr %v; body: %s", rr.Code, opts.wantErr, rr.Body.String())
+		}
+		if gotQuery != opts.wantQuery {
+			t.Fatalf("unexpected upstream query %q; want %q", gotQuery, opts.wantQuery)
+		}
+	}
+
+	// configured endpoint is proxied
+	o := opts{
+		path:      "/select/logsql/stream_ids",
+		body:      `{"query":"*","offset":"10"}`,
+		wantQuery: "offset=10&query=%2A",
+	}
+	f(o)
+
+	// not configured endpoint isn't requested
+	o = opts{
+		path:    "/select/logsql/query",
+		body:    `{"query":"*"}`,
+		wantErr: true,
+	}
+	f(o)
+
+	// not allowed arg is dropped
+	o = opts{
+		path:      "/select/logsql/stream_ids",
+		body:      `{"query":"*","limit":"10"}`,
+		wantQuery: "query=%2A",
+	}
+	f(o)
+
+	// the datasource URL query and the custom query params are added
+	o = opts{
+		path:              "/select/logsql/field_names",
+		body:              `{"query":"*"}`,
+		urlQuery:          "/?token=secret",
+		customQueryParams: "timeout=10s",
+		wantQuery:         "query=%2A&timeout=10s&token=secret",
+	}
+	f(o)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/url"
 	"path"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -22,10 +21,46 @@ const (
 	statsQueryPath      = "/select/logsql/stats_query"
 	statsQueryRangePath = "/select/logsql/stats_query_range"
 	hitsQueryPath       = "/select/logsql/hits"
+	facetsQueryPath     = "/select/logsql/facets"
+	fieldNamesPath      = "/select/logsql/field_names"
+	fieldValuesPath     = "/select/logsql/field_values"
+	tenantIDsPath       = "/select/tenant_ids"
+	metricsPath         = "/metrics"
 	defaultMaxLines     = 1000
 	legendFormatAuto    = "__auto"
 	metricsName         = "__name__"
 	defaultInterval     = 15 * time.Second
+	// maxFilledPoints limits the number of buckets materialized per series
+	// when the missing buckets are filled between start and end
+	maxFilledPoints = 11000
+)
+
+const (
+	// normalizePerSecond divides bucket values by the step in seconds
+	normalizePerSecond = "per_second"
+)
+
+const (
+	// formatTable returns instant stats as a single numeric wide frame
+	formatTable = "table"
+	// formatHistogram converts `vmrange` series of the `histogram` stats function into heatmap frames
+	formatHistogram = "histogram"
+)
+
+const (
+	// fillNull fills missing steps of range series with null values
+	fillNull = "null"
+	// fillZero fills missing steps of range series with zeros
+	fillZero = "zero"
+	// fillPrevious fills missing steps of range series with the previous value
+	fillPrevious = "previous"
+)
+
+const (
+	// alertValuePresence returns 1 if any log is matched by the raw logs query in alerts and 0 otherwise
+	alertValuePresence = "presence"
+	// alertLogsCountName is the stats result name of the raw logs query in alerts
+	alertLogsCountName = "logs"
 )
 
 // QueryType represents query type
@@ -40,6 +75,10 @@ const (
 	QueryTypeStatsRange QueryType = "statsRange"
 	// QueryTypeHits represents hits query type
 	QueryTypeHits QueryType = "hits"
+	// QueryTypeAnnotations represents annotations query type
+	QueryTypeAnnotations QueryType = "annotations"
+	// QueryTypeFacets represents facets query type
+	QueryTypeFacets QueryType = "facets"
 )
 
 // Query represents backend query object
@@ -58,8 +97,36 @@ type Query struct {
 	ExtraFilters       string    `json:"extraFilters"`
 	ExtraStreamFilters string    `json:"extraStreamFilters"`
 	TimezoneOffset     string    `json:"timezoneOffset"`
-	url                *url.URL
-	ForAlerting        bool `json:"-"`
+	Normalize          string    `json:"normalize"`
+	HitsTotals         bool      `json:"hitsTotals"`
+	TopN               int       `json:"topN"`
+	Fill               string    `json:"fill"`
+	Format             string    `json:"format"`
+	// HistogramCumulative makes bucket counts cumulative for the histogram format
+	HistogramCumulative bool `json:"histogramCumulative"`
+	// AlertValue defines the value returned by the raw logs query in alerts,
+	// it is the number of matched logs by default
+	AlertValue string `json:"alertValue"`
+	// AlertSampleLines is the number of recent log lines attached to every series of the stats query in alerts
+	AlertSampleLines int `json:"alertSampleLines"`
+	// Annotation describes how log entries are mapped to annotations for the annotations query type
+	Annotation AnnotationOptions `json:"annotation"`
+	// Facets describes the most frequent field values returned by the facets query type
+	Facets FacetsOptions `json:"facets"`
+	// TailBackfill is the time window, e.g. `5m`, or the number of log lines, e.g. `100`,
+	// shown in the live mode before new log lines arrive
+	TailBackfill string `json:"tailBackfill"`
+	// LiveWindow is the sliding window of stats range and hits queries in the live mode
+	LiveWindow string `json:"liveWindow"`
+
+	url    *url.URL
+	legend *legendTemplate
+	step   time.Duration
+	offset time.Duration
+	// tailStartOffset makes the resumed live tail return logs since the last delivered row
+	tailStartOffset time.Duration
+
+	ForAlerting bool `json:"-"`
 }
 
 // GetQueryURL calculates step and clear expression from template variables,
@@ -102,12 +169,105 @@ func (q *Query) getQueryURL(rawURL string, queryParams string) (string, error) {
 			return "", fmt.Errorf("failed to calculate minimal interval: %w", err)
 		}
 		return q.hitsQueryURL(params, minInterval), nil
+	case QueryTypeFacets:
+		return q.facetsQueryURL(params), nil
 	default:
+		if q.ForAlerting {
+			return q.logsAlertingURL(params)
+		}
 		return q.queryInstantURL(params), nil
 	}
 }
 
-// queryInstantURL prepare query url for instant query
+// logsAlertingURL prepare query url for the raw logs query in alerts.
+// Alerting can't reduce log lines, so the query counts matched logs instead.
+// The query expression isn't changed, the count is requested by its copy.
+func (q *Query) logsAlertingURL(queryParams url.Values) (string, error) {
+	for _, pipe := range splitLogsQLPipes(q.Expr)[1:] {
+		if name := limitingPipeName(pipe); name != "" {
+			return "", fmt.Errorf("raw logs alerting query can't contain the %q pipe since it changes the number of matched logs; use the stats query type instead", name)
+		}
+	}
+	cq := *q
+	cq.Expr = fmt.Sprintf("%s | stats count() %s", q.Expr, alertLogsCountName)
+	u := cq.statsQueryURL(queryParams)
+	q.url = cq.url
+	return u, nil
+}
+
+// limitingPipes are the pipes which limit or aggregate logs
+var limitingPipes = map[string]struct{}{
+	"limit": {}, "head": {}, "offset": {}, "skip": {}, "first": {}, "last": {}, "top": {}, "uniq": {},
+	"sample": {}, "stats": {}, "facets": {}, "field_names": {}, "field_values": {}, "block_stats": {},
+	"running_stats": {}, "total_stats": {}, "join": {}, "union": {},
+}
+
+// statsFuncs are the stats functions which can be used as a pipe without the `stats` keyword
+var statsFuncs = map[string]struct{}{
+	"avg": {}, "count": {}, "count_empty": {}, "count_uniq": {}, "count_uniq_hash": {}, "histogram": {},
+	"json_values": {}, "max": {}, "median": {}, "min": {}, "quantile": {}, "rate": {}, "rate_sum": {},
+	"row_any": {}, "row_max": {}, "row_min": {}, "sum": {}, "sum_len": {}, "uniq_values": {}, "values": {},
+}
+
+// limitingPipeName returns the name of the pipe if it limits or aggregates logs.
+// Stats pipes without the `stats` keyword, e.g. `count()` or `by (host) count()`, are detected too.
+func limitingPipeName(pipe string) string {
+	pipe = strings.TrimSpace(pipe)
+	name := pipe
+	if i := strings.IndexAny(pipe, " \t("); i >= 0 {
+		name = pipe[:i]
+	}
+	name = strings.ToLower(name)
+	if _, ok := limitingPipes[name]; ok {
+		return name
+	}
+	rest := strings.TrimSpace(pipe[len(name):])
+	if _, ok := statsFuncs[name]; ok && strings.HasPrefix(rest, "(") {
+		return "stats"
+	}
+	switch name {
+	case "by":
+		return "stats"
+	case "sort", "order":
+		for _, token := range strings.Fields(strings.ToLower(rest)) {
+			if token == "limit" || token == "offset" {
+				return name + " " + token
+			}
+		}
+	}
+	return ""
+}
+
+// splitLogsQLPipes splits the expression by the pipe delimiters outside quoted strings and subqueries.
+// The first part is the filter of the expression.
+func splitLogsQLPipes(expr string) []string {
+	var parts []string
+	var quote byte
+	var depth, start int
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// queryTailURL prepare query url for the live tail
 func (q *Query) queryTailURL(rawURL string, queryParams string) (string, error) {
 	if rawURL == "" {
 		return "", fmt.Errorf("url can't be blank")
@@ -132,13 +292,47 @@ func (q *Query) queryTailURL(rawURL string, queryParams string) (string, error)
 		}
 	}
 
+	if q.ExtraFilters != "" {
+		values.Set("extra_filters", q.ExtraFilters)
+	}
+	if q.ExtraStreamFilters != "" {
+		values.Set("extra_stream_filters", q.ExtraStreamFilters)
+	}
+
+	// the backfill is requested by the separate query for every live stream, see backfillTail
+	if _, _, err := q.tailBackfill(); err != nil {
+		return "", err
+	}
+
 	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
 	values.Set("query", q.Expr)
+	if q.tailStartOffset > 0 {
+		values.Set("start_offset", fmt.Sprintf("%ds", int64(q.tailStartOffset.Seconds())))
+	}
 
 	q.url.RawQuery = values.Encode()
 	return q.url.String(), nil
 }
 
+// tailBackfill returns either the number of log lines or the time window
+// which must be shown before the live tail starts
+func (q *Query) tailBackfill() (int, time.Duration, error) {
+	if q.TailBackfill == "" {
+		return 0, 0, nil
+	}
+	if n, err := strconv.Atoi(q.TailBackfill); err == nil {
+		if n < 0 {
+			return 0, 0, fmt.Errorf("tail backfill can't be negative: %d", n)
+		}
+		return n, 0, nil
+	}
+	d, err := utils.ParseDuration(q.TailBackfill)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse tail backfill %q: %w", q.TailBackfill, err)
+	}
+	return 0, d, nil
+}
+
 // queryInstantURL prepare query url for instant query
 func (q *Query) queryInstantURL(queryParams url.Values) string {
 	q.url.Path = path.Join(q.url.Path, instantQueryPath)
@@ -228,6 +422,8 @@ func (q *Query) statsQueryRangeURL(queryParams url.Values, minInterval time.Dura
 		step = utils.CalculateStep(minInterval, q.TimeRange, q.MaxDataPoints).String()
 	}
 
+	q.setBuckets(step)
+
 	values.Set("query", q.Expr)
 	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
 	values.Set("end", strconv.FormatInt(q.TimeRange.To.Unix(), 10))
@@ -266,6 +462,8 @@ func (q *Query) hitsQueryURL(queryParams url.Values, minInterval time.Duration)
 		step = utils.CalculateStep(minInterval, q.TimeRange, q.MaxDataPoints).String()
 	}
 
+	q.setBuckets(step)
+
 	values.Set("query", q.Expr)
 	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
 	values.Set("end", strconv.FormatInt(q.TimeRange.To.Unix(), 10))
@@ -276,11 +474,90 @@ func (q *Query) hitsQueryURL(queryParams url.Values, minInterval time.Duration)
 	for _, f := range q.Fields {
 		values.Add("field", f)
 	}
+	if q.TopN > 0 && len(q.Fields) > 0 {
+		// let VictoriaLogs limit the number of groups,
+		// the rest of them are merged into the other series by the plugin
+		values.Set("fields_limit", strconv.Itoa(q.TopN))
+	}
+
+	q.url.RawQuery = values.Encode()
+	return q.url.String()
+}
+
+// facetsQueryURL prepare query url for querying the most frequent values per log field
+func (q *Query) facetsQueryURL(queryParams url.Values) string {
+	q.url.Path = path.Join(q.url.Path, facetsQueryPath)
+	values := q.url.Query()
+
+	for k, vl := range queryParams {
+		for _, v := range vl {
+			values.Add(k, v)
+		}
+	}
+
+	now := time.Now()
+	if q.TimeRange.From.IsZero() {
+		q.TimeRange.From = now.Add(-time.Minute * 5)
+	}
+	if q.TimeRange.To.IsZero() {
+		q.TimeRange.To = now
+	}
+
+	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
+	values.Set("query", q.Expr)
+	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
+	values.Set("end", strconv.FormatInt(q.TimeRange.To.Unix(), 10))
+	if q.Facets.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Facets.Limit))
+	}
+	if q.Facets.MaxValuesPerField > 0 {
+		values.Set("max_values_per_field", strconv.Itoa(q.Facets.MaxValuesPerField))
+	}
+	if q.Facets.KeepConstFields {
+		values.Set("keep_const_fields", "1")
+	}
 
 	q.url.RawQuery = values.Encode()
 	return q.url.String()
 }
 
+// setBuckets remembers the step and the timezone offset of the requested buckets.
+// Invalid values are left for VictoriaLogs to report, so buckets are just not aligned then.
+func (q *Query) setBuckets(step string) {
+	if d, err := utils.ParseDuration(step); err == nil && d > 0 {
+		q.step = d
+	}
+	if q.TimezoneOffset != "" {
+		if d, err := utils.ParseDuration(q.TimezoneOffset); err == nil {
+			q.offset = d
+		}
+	}
+}
+
+// stepGrid returns the bucket timestamps between the query start and end.
+// Buckets are aligned to the given anchor timestamp if it is set,
+// otherwise to the step and the timezone offset.
+// It returns nil if the step is unknown or the grid is too large.
+func (q *Query) stepGrid(anchor time.Time) []time.Time {
+	if q.step <= 0 || q.TimeRange.From.IsZero() || q.TimeRange.To.Before(q.TimeRange.From) {
+		return nil
+	}
+	offset := q.offset
+	if !anchor.IsZero() {
+		offset = -time.Duration(anchor.UnixNano() % int64(q.step))
+	}
+	first := utils.AlignTime(q.TimeRange.From, q.step, offset)
+	n := int(q.TimeRange.To.Sub(first)/q.step) + 1
+	if n <= 0 || n > maxFilledPoints {
+		return nil
+	}
+	grid := make([]time.Time, n)
+	for i := range grid {
+		grid[i] = first.Add(time.Duration(i) * q.step)
+	}
+	return grid
+}
+
 func (q *Query) addMetadataToMultiFrame(frame *data.Frame) {
 	if len(frame.Fields) < 2 {
 		return
@@ -303,23 +580,19 @@ func (q *Query) addIntervalToFrame(frame *data.Frame) {
 	}
 }
 
-var legendReplacer = regexp.MustCompile(`\{\{\s*(.+?)\s*\}\}`)
-
 func (q *Query) parseLegend(labels data.Labels) string {
-
 	switch {
 	case q.LegendFormat == legendFormatAuto:
-		return q.Expr
+		legend := q.autoLegend(labels)
+		if legend == "" {
+			return q.Expr
+		}
+		return legend
 	case q.LegendFormat != "":
-		result := legendReplacer.ReplaceAllStringFunc(q.LegendFormat, func(in string) string {
-			labelName := strings.Replace(in, "{{", "", 1)
-			labelName = strings.Replace(labelName, "}}", "", 1)
-			labelName = strings.TrimSpace(labelName)
-			if val, ok := labels[labelName]; ok {
-				return val
-			}
-			return ""
-		})
+		if q.legend == nil || q.legend.format != q.LegendFormat {
+			q.legend = newLegendTemplate(q.LegendFormat)
+		}
+		result := q.legend.execute(labels)
 		if result == "" {
 			return q.Expr
 		}
@@ -16,6 +16,10 @@ func TestQuery_getQueryURL(t *testing.T) {
 		QueryType      QueryType
 		ExtraFilters   string
 		TimezoneOffset string
+		Fields         []string
+		TopN           int
+		ForAlerting    bool
+		Facets         FacetsOptions
 		rawURL         string
 		queryParams    string
 		want           string
@@ -34,6 +38,10 @@ func TestQuery_getQueryURL(t *testing.T) {
 			QueryType:      opts.QueryType,
 			ExtraFilters:   opts.ExtraFilters,
 			TimezoneOffset: opts.TimezoneOffset,
+			Fields:         opts.Fields,
+			TopN:           opts.TopN,
+			ForAlerting:    opts.ForAlerting,
+			Facets:         opts.Facets,
 		}
 		got, err := q.getQueryURL(opts.rawURL, opts.queryParams)
 		if (err != nil) != opts.wantErr {
@@ -43,6 +51,9 @@ func TestQuery_getQueryURL(t *testing.T) {
 		if got != opts.want {
 			t.Errorf("getQueryURL() got = %v, want %v", got, opts.want)
 		}
+		if opts.ForAlerting && q.Expr != opts.Expr {
+			t.Errorf("getQueryURL() changed the query expression to %q", q.Expr)
+		}
 	}
 
 	// empty values
@@ -465,19 +476,110 @@ func TestQuery_getQueryURL(t *testing.T) {
 		want:           "http://127.0.0.1:9429/select/logsql/hits?end=1609462800&query=_time%3A1s&start=1609459200&step=15s",
 	}
 	f(o)
+
+	// hits grouped by field with top N limit
+	o = opts{
+		RefID:    "1",
+		Expr:     "_time:1s",
+		MaxLines: 10,
+		TimeRange: backend.TimeRange{
+			From: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+		},
+		QueryType: QueryTypeHits,
+		Fields:    []string{"host"},
+		TopN:      5,
+		rawURL:    "http://127.0.0.1:9429",
+		want:      "http://127.0.0.1:9429/select/logsql/hits?end=1609462800&field=host&fields_limit=5&query=_time%3A1s&start=1609459200&step=15s",
+	}
+	f(o)
+
+	// raw logs query in alerts counts matched logs
+	o = opts{
+		RefID: "1",
+		Expr:  "error",
+		TimeRange: backend.TimeRange{
+			From: time.Unix(1609459200, 0),
+			To:   time.Unix(1609462800, 0),
+		},
+		QueryType:   QueryTypeInstant,
+		ForAlerting: true,
+		rawURL:      "http://127.0.0.1:9429",
+		want:        "http://127.0.0.1:9429/select/logsql/stats_query?query=_time%3A%5B1609459200%2C+1609462800%5D+error+%7C+stats+count%28%29+logs&time=1609462800",
+	}
+	f(o)
+
+	// raw logs query in alerts with filtering pipes and quoted pipe delimiters
+	o = opts{
+		RefID: "1",
+		Expr:  `"a | limit 1" | extract "user=<user> " | filter user:in(* | limit 5 | fields user) | sort by (_time)`,
+		TimeRange: backend.TimeRange{
+			From: time.Unix(1609459200, 0),
+			To:   time.Unix(1609462800, 0),
+		},
+		QueryType:   QueryTypeInstant,
+		ForAlerting: true,
+		rawURL:      "http://127.0.0.1:9429",
+		want:        "http://127.0.0.1:9429/select/logsql/stats_query?query=_time%3A%5B1609459200%2C+1609462800%5D+%22a+%7C+limit+1%22+%7C+extract+%22user%3D%3Cuser%3E+%22+%7C+filter+user%3Ain%28%2A+%7C+limit+5+%7C+fields+user%29+%7C+sort+by+%28_time%29+%7C+stats+count%28%29+logs&time=1609462800",
+	}
+	f(o)
+
+	// raw logs query in alerts can't limit the number of matched logs
+	for _, expr := range []string{
+		"error | limit 10",
+		"error | head 10",
+		"error | sort by (_time desc) limit 10",
+		"error | stats count() hits",
+		"error | by (host) count()",
+		"error | count() hits",
+		"error | uniq by (host)",
+	} {
+		o = opts{
+			RefID: "1",
+			Expr:  expr,
+			TimeRange: backend.TimeRange{
+				From: time.Unix(1609459200, 0),
+				To:   time.Unix(1609462800, 0),
+			},
+			QueryType:   QueryTypeInstant,
+			ForAlerting: true,
+			rawURL:      "http://127.0.0.1:9429",
+			wantErr:     true,
+		}
+		f(o)
+	}
+	// facets with options
+	o = opts{
+		RefID: "1",
+		Expr:  "error",
+		TimeRange: backend.TimeRange{
+			From: time.Unix(1609459200, 0),
+			To:   time.Unix(1609462800, 0),
+		},
+		QueryType:    QueryTypeFacets,
+		ExtraFilters: "app:api",
+		Facets:       FacetsOptions{Limit: 5, MaxValuesPerField: 100, KeepConstFields: true},
+		rawURL:       "http://127.0.0.1:9429",
+		want:         "http://127.0.0.1:9429/select/logsql/facets?end=1609462800&extra_filters=app%3Aapi&keep_const_fields=1&limit=5&max_values_per_field=100&query=error&start=1609459200",
+	}
+	f(o)
 }
 
 func TestQuery_queryTailURL(t *testing.T) {
 	type opts struct {
-		RefID       string
-		Expr        string
-		MaxLines    int
-		TimeRange   backend.TimeRange
-		QueryType   QueryType
-		rawURL      string
-		queryParams string
-		want        string
-		wantErr     bool
+		RefID              string
+		Expr               string
+		MaxLines           int
+		TimeRange          backend.TimeRange
+		QueryType          QueryType
+		ExtraFilters       string
+		ExtraStreamFilters string
+		TailBackfill       string
+		tailStartOffset    time.Duration
+		rawURL             string
+		queryParams        string
+		want               string
+		wantErr            bool
 	}
 	f := func(opts opts) {
 		t.Helper()
@@ -487,8 +589,12 @@ func TestQuery_queryTailURL(t *testing.T) {
 				QueryType: string(opts.QueryType),
 				TimeRange: opts.TimeRange,
 			},
-			Expr:     opts.Expr,
-			MaxLines: opts.MaxLines,
+			Expr:               opts.Expr,
+			MaxLines:           opts.MaxLines,
+			ExtraFilters:       opts.ExtraFilters,
+			ExtraStreamFilters: opts.ExtraStreamFilters,
+			TailBackfill:       opts.TailBackfill,
+			tailStartOffset:    opts.tailStartOffset,
 		}
 		got, err := q.queryTailURL(opts.rawURL, opts.queryParams)
 		if (err != nil) != opts.wantErr {
@@ -551,4 +657,61 @@ func TestQuery_queryTailURL(t *testing.T) {
 		want:        "http://127.0.0.1:9428/select/logsql/tail?a=1&b=2&query=_time%3A1s+and+syslog",
 	}
 	f(o)
+
+	// with extra filters
+	o = opts{
+		RefID:              "1",
+		Expr:               "error",
+		QueryType:          QueryTypeInstant,
+		ExtraFilters:       `{"job":"app"}`,
+		ExtraStreamFilters: `{"env":"prod"}`,
+		rawURL:             "http://127.0.0.1:9428",
+		want:               "http://127.0.0.1:9428/select/logsql/tail?extra_filters=%7B%22job%22%3A%22app%22%7D&extra_stream_filters=%7B%22env%22%3A%22prod%22%7D&query=error",
+	}
+	f(o)
+
+	// backfill with the time window is requested by the instant query
+	o = opts{
+		RefID:        "1",
+		Expr:         "error",
+		QueryType:    QueryTypeInstant,
+		TailBackfill: "5m",
+		rawURL:       "http://127.0.0.1:9428",
+		want:         "http://127.0.0.1:9428/select/logsql/tail?query=error",
+	}
+	f(o)
+
+	// backfill with the number of lines is requested by the instant query
+	o = opts{
+		RefID:        "1",
+		Expr:         "error",
+		QueryType:    QueryTypeInstant,
+		TailBackfill: "100",
+		rawURL:       "http://127.0.0.1:9428",
+		want:         "http://127.0.0.1:9428/select/logsql/tail?query=error",
+	}
+	f(o)
+
+	// resumed tail
+	o = opts{
+		RefID:           "1",
+		Expr:            "error",
+		QueryType:       QueryTypeInstant,
+		TailBackfill:    "5m",
+		tailStartOffset: 7 * time.Second,
+		rawURL:          "http://127.0.0.1:9428",
+		want:            "http://127.0.0.1:9428/select/logsql/tail?query=error&start_offset=7s",
+	}
+	f(o)
+
+	// invalid backfill
+	o = opts{
+		RefID:        "1",
+		Expr:         "error",
+		QueryType:    QueryTypeInstant,
+		TailBackfill: "abc",
+		rawURL:       "http://127.0.0.1:9428",
+		wantErr:      true,
+	}
+	f(o)
 }
@@ -20,6 +20,7 @@ const (
 	gTimeField   = "Time"
 	gLineField   = "Line"
 	gValueField  = "Value"
+	gTotalField  = "Total"
 	gIDField     = "id"
 
 	logsVisualisation = "logs"
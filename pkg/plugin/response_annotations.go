@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
+)
+
+const (
+	gAnnotationTimeField    = "time"
+	gAnnotationTimeEndField = "timeEnd"
+	gAnnotationTitleField   = "title"
+	gAnnotationTextField    = "text"
+	gAnnotationTagsField    = "tags"
+
+	// defaultAnnotationTextTemplate shows the log message as the annotation text
+	defaultAnnotationTextTemplate = "{{_msg}}"
+)
+
+// AnnotationOptions describes how log entries are mapped to annotation events.
+// Log fields include the stream labels of the log entry.
+type AnnotationOptions struct {
+	// TitleField is the log field used as the annotation title
+	TitleField string `json:"titleField"`
+	// TextTemplate is the annotation text in the legend format, e.g. `{{level | upper}}: {{_msg}}`
+	TextTemplate string `json:"textTemplate"`
+	// TagFields are the log fields which values are used as annotation tags
+	TagFields []string `json:"tagFields"`
+	// StreamTags adds values of all stream labels to annotation tags
+	StreamTags bool `json:"streamTags"`
+	// TimeEndField is the log field with the end time of the region annotation
+	TimeEndField string `json:"timeEndField"`
+	// DurationField is the log field with the duration of the region annotation,
+	// it is used if TimeEndField isn't set or is missing in the log entry
+	DurationField string `json:"durationField"`
+}
+
+// isRegion checks whether annotations have the end time
+func (o AnnotationOptions) isRegion() bool {
+	return o.TimeEndField != "" || o.DurationField != ""
+}
+
+// parseAnnotationsResponse converts log entries into a Grafana annotations frame
+func parseAnnotationsResponse(reader io.Reader, q *Query) backend.DataResponse {
+	opts := q.Annotation
+	textTemplate := opts.TextTemplate
+	if textTemplate == "" {
+		textTemplate = defaultAnnotationTextTemplate
+	}
+	text := newLegendTemplate(textTemplate)
+
+	timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, 0)
+	timeFd.Name = gAnnotationTimeField
+	timeEndFd := data.NewFieldFromFieldType(data.FieldTypeNullableTime, 0)
+	timeEndFd.Name = gAnnotationTimeEndField
+	titleFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+	titleFd.Name = gAnnotationTitleField
+	textFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+	textFd.Name = gAnnotationTextField
+	tagsFd := data.NewFieldFromFieldType(data.FieldTypeJSON, 0)
+	tagsFd.Name = gAnnotationTagsField
+
+	var parser fastjson.Parser
+	var rowErr error
+	err := readLogRows(reader, func(row logRow) {
+		if rowErr != nil {
+			return
+		}
+		fields, err := annotationFields(&parser, row)
+		if err != nil {
+			rowErr = err
+			return
+		}
+
+		tags, err := json.Marshal(opts.tags(fields, row.Stream))
+		if err != nil {
+			rowErr = fmt.Errorf("cannot marshal annotation tags: %w", err)
+			return
+		}
+
+		timeFd.Append(row.Time)
+		timeEndFd.Append(opts.timeEnd(row.Time, fields))
+		titleFd.Append(fields[opts.TitleField])
+		textFd.Append(text.execute(fields))
+		tagsFd.Append(json.RawMessage(tags))
+	})
+	if err == nil {
+		err = rowErr
+	}
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+
+	frame := data.NewFrame("", timeFd)
+	if opts.isRegion() {
+		frame.Fields = append(frame.Fields, timeEndFd)
+	}
+	if opts.TitleField != "" {
+		frame.Fields = append(frame.Fields, titleFd)
+	}
+	frame.Fields = append(frame.Fields, textFd, tagsFd)
+	frame.SetMeta(&data.FrameMeta{DataTopic: data.DataTopicAnnotations})
+
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// annotationFields returns all fields of the log entry as strings.
+// Stream labels are included, since VictoriaLogs returns them only in `_stream`,
+// fields of the log entry take precedence over them.
+func annotationFields(parser *fastjson.Parser, row logRow) (data.Labels, error) {
+	fields := make(data.Labels, len(row.Stream))
+	for k, v := range row.Stream {
+		fields[k] = v
+	}
+	if len(row.Labels) > 0 {
+		v, err := parser.ParseBytes(row.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse log fields: %w", err)
+		}
+		obj, err := v.Object()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse log fields: %w", err)
+		}
+		obj.Visit(func(key []byte, v *fastjson.Value) {
+			if v.Type() == fastjson.TypeString {
+				fields[string(key)] = string(v.GetStringBytes())
+				return
+			}
+			fields[string(key)] = v.String()
+		})
+	}
+	fields[messageField] = row.Line
+	if !row.Time.IsZero() {
+		fields[timeField] = row.Time.Format(time.RFC3339Nano)
+	}
+	return fields, nil
+}
+
+// tags returns non-empty values of the tag fields and optionally of the stream labels
+func (o AnnotationOptions) tags(fields data.Labels, stream map[string]string) []string {
+	tags := make([]string, 0, len(o.TagFields))
+	seen := make(map[string]struct{})
+	add := func(tag string) {
+		if tag == "" {
+			return
+		}
+		if _, ok := seen[tag]; ok {
+			return
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	for _, name := range o.TagFields {
+		add(fields[name])
+	}
+	if o.StreamTags {
+		names := make([]string, 0, len(stream))
+		for name := range stream {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(stream[name])
+		}
+	}
+	return tags
+}
+
+// timeEnd returns the end time of the region annotation or nil
+// if the log entry has neither end time nor duration
+func (o AnnotationOptions) timeEnd(start time.Time, fields data.Labels) *time.Time {
+	if v := fields[o.TimeEndField]; o.TimeEndField != "" && v != "" {
+		if t, err := utils.GetTime(v); err == nil {
+			return &t
+		}
+	}
+	if v := fields[o.DurationField]; o.DurationField != "" && v != "" {
+		if d, ok := parseAnnotationDuration(v); ok {
+			t := start.Add(d)
+			return &t
+		}
+	}
+	return nil
+}
+
+// parseAnnotationDuration parses the duration in seconds, e.g. `1.5`, or in the duration format, e.g. `1m30s`
+func parseAnnotationDuration(s string) (time.Duration, bool) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	d, err := utils.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
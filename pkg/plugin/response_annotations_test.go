@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func Test_parseAnnotationsResponse(t *testing.T) {
+	type opts struct {
+		response string
+		options  AnnotationOptions
+		want     func() *data.Frame
+	}
+	f := func(opts opts) {
+		t.Helper()
+		resp := parseAnnotationsResponse(bytes.NewBufferString(opts.response), &Query{Annotation: opts.options})
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		}
+
+		got, err := resp.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal response: %s", err)
+		}
+		want, err := backend.DataResponse{Frames: data.Frames{opts.want()}}.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal want response: %s", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("\n got value: %s, \n want value: %s", got, want)
+		}
+	}
+
+	ts1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	ts2 := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+	response := `{"_time":"2024-01-01T10:00:00Z","_msg":"deploy started","_stream":"{app=\"api\",env=\"prod\"}","version":"v1.2","duration":"90"}
+{"_time":"2024-01-01T11:00:00Z","_msg":"deploy started","_stream":"{app=\"web\",env=\"prod\"}","version":"v2.0","finished":"2024-01-01T11:05:00Z"}`
+
+	// point annotations with the message as text
+	o := opts{
+		response: response,
+		want: func() *data.Frame {
+			return data.NewFrame("",
+				data.NewField(gAnnotationTimeField, nil, []time.Time{ts1, ts2}),
+				data.NewField(gAnnotationTextField, nil, []string{"deploy started", "deploy started"}),
+				data.NewField(gAnnotationTagsField, nil, []json.RawMessage{json.RawMessage(`[]`), json.RawMessage(`[]`)}),
+			).SetMeta(&data.FrameMeta{DataTopic: data.DataTopicAnnotations})
+		},
+	}
+	f(o)
+
+	// region annotations with title, text template and tags,
+	// the text template uses stream labels and the default value for missing fields
+	o = opts{
+		response: response,
+		options: AnnotationOptions{
+			TitleField:    "version",
+			TextTemplate:  `{{app | "unknown"}}/{{team | "unknown"}}: {{_msg}}`,
+			TagFields:     []string{"version", "missing"},
+			StreamTags:    true,
+			TimeEndField:  "finished",
+			DurationField: "duration",
+		},
+		want: func() *data.Frame {
+			end1 := ts1.Add(90 * time.Second)
+			end2 := ts2.Add(5 * time.Minute)
+			return data.NewFrame("",
+				data.NewField(gAnnotationTimeField, nil, []time.Time{ts1, ts2}),
+				data.NewField(gAnnotationTimeEndField, nil, []*time.Time{&end1, &end2}),
+				data.NewField(gAnnotationTitleField, nil, []string{"v1.2", "v2.0"}),
+				data.NewField(gAnnotationTextField, nil, []string{"api/unknown: deploy started", "web/unknown: deploy started"}),
+				data.NewField(gAnnotationTagsField, nil, []json.RawMessage{json.RawMessage(`["v1.2","api","prod"]`), json.RawMessage(`["v2.0","web","prod"]`)}),
+			).SetMeta(&data.FrameMeta{DataTopic: data.DataTopicAnnotations})
+		},
+	}
+	f(o)
+
+	// missing end time and duration result in point annotations
+	o = opts{
+		response: `{"_time":"2024-01-01T10:00:00Z","_msg":"restart","duration":"invalid"}`,
+		options:  AnnotationOptions{DurationField: "duration"},
+		want: func() *data.Frame {
+			return data.NewFrame("",
+				data.NewField(gAnnotationTimeField, nil, []time.Time{ts1}),
+				data.NewField(gAnnotationTimeEndField, nil, []*time.Time{nil}),
+				data.NewField(gAnnotationTextField, nil, []string{"restart"}),
+				data.NewField(gAnnotationTagsField, nil, []json.RawMessage{json.RawMessage(`[]`)}),
+			).SetMeta(&data.FrameMeta{DataTopic: data.DataTopicAnnotations})
+		},
+	}
+	f(o)
+
+	// fields of the log entry take precedence over stream labels
+	o = opts{
+		response: `{"_time":"2024-01-01T10:00:00Z","_msg":"restart","_stream":"{app=\"api\"}","app":"api-canary"}`,
+		options:  AnnotationOptions{TextTemplate: "{{app}}"},
+		want: func() *data.Frame {
+			return data.NewFrame("",
+				data.NewField(gAnnotationTimeField, nil, []time.Time{ts1}),
+				data.NewField(gAnnotationTextField, nil, []string{"api-canary"}),
+				data.NewField(gAnnotationTagsField, nil, []json.RawMessage{json.RawMessage(`[]`)}),
+			).SetMeta(&data.FrameMeta{DataTopic: data.DataTopicAnnotations})
+		},
+	}
+	f(o)
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	facetsFieldName = "field"
+	facetsValueName = "value"
+	facetsHitsName  = "hits"
+)
+
+// FacetsResponse represents response from the facets query
+type FacetsResponse struct {
+	Facets []Facet `json:"facets"`
+	// SkippedFields is the number of fields skipped by the facets fallback, see maxFacetsFallbackFields
+	SkippedFields int `json:"skipped_fields,omitempty"`
+}
+
+// Facet contains the most frequent values of a single log field
+type Facet struct {
+	FieldName string       `json:"field_name"`
+	Values    []FacetValue `json:"values"`
+}
+
+// FacetValue represents a single field value with the number of logs containing it
+type FacetValue struct {
+	FieldValue string `json:"field_value"`
+	Hits       uint64 `json:"hits"`
+}
+
+func parseFacetsResponse(reader io.Reader, q *Query) backend.DataResponse {
+	var fr FacetsResponse
+	if err := json.NewDecoder(reader).Decode(&fr); err != nil {
+		err = fmt.Errorf("failed to decode body response: %w", err)
+		return newResponseError(err, backend.StatusInternal)
+	}
+	return backend.DataResponse{Frames: data.Frames{fr.getDataFrame(q)}}
+}
+
+// getDataFrame returns a table frame with a row per field value.
+// Only the query fields are returned if they are set.
+func (fr *FacetsResponse) getDataFrame(q *Query) *data.Frame {
+	fieldFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+	fieldFd.Name = facetsFieldName
+	valueFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+	valueFd.Name = facetsValueName
+	hitsFd := data.NewFieldFromFieldType(data.FieldTypeUint64, 0)
+	hitsFd.Name = facetsHitsName
+
+	fields := make(map[string]struct{}, len(q.Fields))
+	for _, f := range q.Fields {
+		fields[f] = struct{}{}
+	}
+	for _, facet := range fr.Facets {
+		if _, ok := fields[facet.FieldName]; len(fields) > 0 && !ok {
+			continue
+		}
+		for _, v := range facet.Values {
+			fieldFd.Append(facet.FieldName)
+			valueFd.Append(v.FieldValue)
+			hitsFd.Append(v.Hits)
+		}
+	}
+
+	frame := data.NewFrame("", fieldFd, valueFd, hitsFd)
+	frame.Meta = &data.FrameMeta{
+		PreferredVisualization: data.VisTypeTable,
+	}
+	return frame
+}
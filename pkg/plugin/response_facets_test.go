@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func Test_parseFacetsResponse(t *testing.T) {
+	type opts struct {
+		response string
+		fields   []string
+		want     func() *data.Frame
+	}
+	f := func(opts opts) {
+		t.Helper()
+		resp := parseFacetsResponse(bytes.NewBufferString(opts.response), &Query{Fields: opts.fields})
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		}
+
+		got, err := resp.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal response: %s", err)
+		}
+		want, err := backend.DataResponse{Frames: data.Frames{opts.want()}}.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal want response: %s", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("\n got value: %s, \n want value: %s", got, want)
+		}
+	}
+
+	frame := func(fields, values []string, hits []uint64) func() *data.Frame {
+		return func() *data.Frame {
+			return data.NewFrame("",
+				data.NewField(facetsFieldName, nil, fields),
+				data.NewField(facetsValueName, nil, values),
+				data.NewField(facetsHitsName, nil, hits),
+			).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable})
+		}
+	}
+	response := `{"facets":[
+{"field_name":"level","values":[{"field_value":"info","hits":10},{"field_value":"error","hits":2}]},
+{"field_name":"app","values":[{"field_value":"api","hits":12}]}
+]}`
+
+	// all fields
+	o := opts{
+		response: response,
+		want:     frame([]string{"level", "level", "app"}, []string{"info", "error", "api"}, []uint64{10, 2, 12}),
+	}
+	f(o)
+
+	// only the query fields
+	o = opts{
+		response: response,
+		fields:   []string{"app"},
+		want:     frame([]string{"app"}, []string{"api"}, []uint64{12}),
+	}
+	f(o)
+
+	// no facets
+	o = opts{
+		response: `{"facets":[]}`,
+		want:     frame([]string{}, []string{}, []uint64{}),
+	}
+	f(o)
+}
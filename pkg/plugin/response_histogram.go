@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// vmrangeLabel contains bucket bounds of the `histogram` stats function, e.g. `1.000e+00...1.136e+00`
+	vmrangeLabel = "vmrange"
+
+	// frameTypeHeatmapCells is the Grafana frame type for heatmap cells,
+	// it isn't declared by the plugin SDK
+	frameTypeHeatmapCells data.FrameType = "heatmap-cells"
+
+	gXMaxField  = "xMax"
+	gYMinField  = "yMin"
+	gYMaxField  = "yMax"
+	gCountField = "count"
+)
+
+// histogramBucket represents a single `vmrange` series
+type histogramBucket struct {
+	yMin, yMax float64
+	counts     map[int64]float64
+}
+
+// histogramGroup contains buckets of the series with the same labels except `vmrange`
+type histogramGroup struct {
+	labels  data.Labels
+	buckets []*histogramBucket
+}
+
+// heatmapDataFrames converts `vmrange` series of the `histogram` stats function
+// into heatmap cells frames, one frame per group of series with the same labels.
+// Series without valid `vmrange` label are skipped and reported by a notice.
+func (ls logStats) heatmapDataFrames(resultType string, q *Query) (data.Frames, error) {
+	var keys []string
+	groups := make(map[string]*histogramGroup)
+	timestampSet := make(map[int64]struct{})
+	var skipped int
+	for _, res := range ls.Result {
+		yMin, yMax, ok := parseVMRange(res.Labels[vmrangeLabel])
+		if !ok {
+			skipped++
+			continue
+		}
+
+		bucket := &histogramBucket{yMin: yMin, yMax: yMax, counts: make(map[int64]float64)}
+		values := res.Values
+		if resultType == vector {
+			values = []Value{res.Value}
+		}
+		for _, value := range values {
+			ts, err := getTimestamp(value[0])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse timestamp for metric %v: %w", res, err)
+			}
+			v, err := getFloatPtr(value[1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse float value for metric %v: %w", res, err)
+			}
+			if v != nil {
+				bucket.counts[ts.UnixNano()] += *v
+			}
+			timestampSet[ts.UnixNano()] = struct{}{}
+		}
+
+		labels := dimensionLabels(res.Labels)
+		delete(labels, vmrangeLabel)
+		key := labelsToString(labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &histogramGroup{labels: labels}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.buckets = append(g.buckets, bucket)
+	}
+
+	timestamps := make([]int64, 0, len(timestampSet))
+	for ts := range timestampSet {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	interval := q.step
+	if len(timestamps) > 1 {
+		interval = time.Duration(timestamps[1] - timestamps[0])
+	}
+
+	frames := make(data.Frames, 0, len(keys))
+	for _, key := range keys {
+		frames = append(frames, groups[key].heatmapFrame(timestamps, interval, q.HistogramCumulative))
+	}
+
+	if skipped > 0 {
+		notice := data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d series without a valid %s label were skipped, the histogram format expects series of the `histogram` stats function", skipped, vmrangeLabel),
+		}
+		if len(frames) == 0 {
+			frames = append(frames, data.NewFrame("").SetMeta(&data.FrameMeta{Type: frameTypeHeatmapCells}))
+		}
+		frames[0].AppendNotices(notice)
+	}
+	return frames, nil
+}
+
+// heatmapFrame returns a heatmap cells frame with a row per timestamp and bucket.
+// Buckets are sorted by their lower bound; missing counts are set to zero.
+func (g *histogramGroup) heatmapFrame(timestamps []int64, interval time.Duration, cumulative bool) *data.Frame {
+	sort.Slice(g.buckets, func(i, j int) bool { return g.buckets[i].yMin < g.buckets[j].yMin })
+
+	n := len(timestamps) * len(g.buckets)
+	xMax := make([]time.Time, 0, n)
+	yMin := make([]float64, 0, n)
+	yMax := make([]float64, 0, n)
+	counts := make([]float64, 0, n)
+	for _, ts := range timestamps {
+		var sum float64
+		for _, b := range g.buckets {
+			count := b.counts[ts]
+			if cumulative {
+				sum += count
+				count = sum
+			}
+			xMax = append(xMax, time.Unix(0, ts).UTC())
+			yMin = append(yMin, b.yMin)
+			yMax = append(yMax, b.yMax)
+			counts = append(counts, count)
+		}
+	}
+
+	xMaxFd := data.NewField(gXMaxField, nil, xMax)
+	if interval > 0 {
+		xMaxFd.Config = &data.FieldConfig{Interval: float64(interval.Milliseconds())}
+	}
+
+	var name string
+	if len(g.labels) > 0 {
+		name = labelsToString(g.labels)
+	}
+	return data.NewFrame(name,
+		xMaxFd,
+		data.NewField(gYMinField, nil, yMin),
+		data.NewField(gYMaxField, nil, yMax),
+		data.NewField(gCountField, g.labels, counts),
+	).SetMeta(&data.FrameMeta{Type: frameTypeHeatmapCells})
+}
+
+// parseVMRange parses bucket bounds from the `vmrange` label value
+func parseVMRange(s string) (float64, float64, bool) {
+	minStr, maxStr, ok := strings.Cut(s, "...")
+	if !ok {
+		return 0, 0, false
+	}
+	yMin, err := strconv.ParseFloat(minStr, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	yMax, err := strconv.ParseFloat(maxStr, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return yMin, yMax, true
+}
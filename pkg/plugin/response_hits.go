@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -11,14 +13,14 @@ import (
 	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
 )
 
-func parseHitsResponse(reader io.Reader) backend.DataResponse {
+func parseHitsResponse(reader io.Reader, q *Query) backend.DataResponse {
 	var hr HitsResponse
 	if err := json.NewDecoder(reader).Decode(&hr); err != nil {
 		err = fmt.Errorf("failed to decode body response: %w", err)
 		return newResponseError(err, backend.StatusInternal)
 	}
 
-	frames, err := hr.getDataFrames()
+	frames, err := hr.getDataFrames(q)
 	if err != nil {
 		err = fmt.Errorf("failed to prepare data from response: %w", err)
 		return newResponseError(err, backend.StatusInternal)
@@ -40,33 +42,72 @@ type HitsResponse struct {
 	Hits []Hit `json:"hits"`
 }
 
-func (hr *HitsResponse) getDataFrames() (data.Frames, error) {
-	frames := make(data.Frames, len(hr.Hits))
+// hitSeries contains parsed timestamps and values of a single hit
+type hitSeries struct {
+	fields     map[string]string
+	total      float64
+	timestamps []time.Time
+	values     []float64
+}
+
+func (hr *HitsResponse) getDataFrames(q *Query) (data.Frames, error) {
+	series := make([]hitSeries, len(hr.Hits))
+	var anchor time.Time
 	for i, hit := range hr.Hits {
 		if len(hit.Timestamps) != len(hit.Values) {
 			return nil, fmt.Errorf("timestamps and values length mismatch: %d != %d", len(hit.Timestamps), len(hit.Values))
 		}
 
-		timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, len(hit.Timestamps))
-		timeFd.Name = gTimeField
-
-		valueFd := data.NewFieldFromFieldType(data.FieldTypeFloat64, len(hit.Values))
-		valueFd.Name = gValueField
-		valueFd.Labels = make(data.Labels)
-
+		timestamps := make([]time.Time, len(hit.Timestamps))
 		for j, ts := range hit.Timestamps {
 			getTime, err := utils.GetTime(ts)
 			if err != nil {
 				return nil, fmt.Errorf("error parse time from _time field: %s", err)
 			}
-			timeFd.Set(j, getTime)
+			timestamps[j] = getTime
 		}
+		if anchor.IsZero() && len(timestamps) > 0 {
+			anchor = timestamps[0]
+		}
+		series[i] = hitSeries{
+			fields:     hit.Fields,
+			total:      hit.getTotal(),
+			timestamps: timestamps,
+			values:     hit.Values,
+		}
+	}
+
+	if q.TopN > 0 {
+		series = topNHits(series, q.TopN)
+	}
+
+	if q.ForAlerting {
+		// alerting can't reduce time series with labels in fields,
+		// so every group is reduced to the total number of hits
+		frames := make(data.Frames, 0, len(series))
+		for _, s := range series {
+			frames = append(frames, s.totalFrame())
+		}
+		return frames, nil
+	}
+
+	// buckets returned by VictoriaLogs define the grid phase,
+	// so the filled buckets always match the existing ones
+	grid := q.stepGrid(anchor)
 
-		for k, v := range hit.Values {
-			valueFd.Set(k, v)
+	frames := make(data.Frames, 0, len(series))
+	for _, s := range series {
+		if grid != nil {
+			s = s.zeroFilled(grid, q.step)
 		}
+		if q.Normalize == normalizePerSecond && q.step > 0 {
+			s = s.perSecond(q.step)
+		}
+
+		timeFd := data.NewField(gTimeField, nil, s.timestamps)
+		valueFd := data.NewField(gValueField, make(data.Labels), s.values)
 
-		for key, value := range hit.Fields {
+		for key, value := range s.fields {
 			valueFd.Labels[key] = value
 			d, err := labelsToJSON(valueFd.Labels)
 			if err != nil {
@@ -75,8 +116,133 @@ func (hr *HitsResponse) getDataFrames() (data.Frames, error) {
 			valueFd.Config = &data.FieldConfig{DisplayNameFromDS: string(d)}
 		}
 
-		frames[i] = data.NewFrame("", timeFd, valueFd)
+		frames = append(frames, data.NewFrame("", timeFd, valueFd).SetMeta(timeSeriesMultiMeta()))
+	}
+
+	if q.HitsTotals {
+		for _, s := range series {
+			frames = append(frames, s.totalFrame())
+		}
 	}
 
 	return frames, nil
 }
+
+// getTotal returns the total number of hits of the group.
+// Older VictoriaLogs versions don't return totals, so they are calculated from the buckets.
+func (hit Hit) getTotal() float64 {
+	if hit.Total != 0 {
+		return float64(hit.Total)
+	}
+	var total float64
+	for _, v := range hit.Values {
+		total += v
+	}
+	return total
+}
+
+// topNHits keeps n series with the largest totals
+// and sums the rest of them into a single series with otherSeriesValue labels
+func topNHits(series []hitSeries, n int) []hitSeries {
+	totals := make([]float64, len(series))
+	for i, s := range series {
+		totals[i] = s.total
+	}
+	top, rest := splitTopN(totals, n)
+
+	result := make([]hitSeries, 0, n+1)
+	for _, i := range top {
+		result = append(result, series[i])
+	}
+	if len(rest) == 0 {
+		return result
+	}
+
+	other := hitSeries{}
+	fields := make([]map[string]string, len(rest))
+	timestamps := make([][]time.Time, len(rest))
+	values := make([][]float64, len(rest))
+	for j, i := range rest {
+		fields[j] = series[i].fields
+		timestamps[j] = series[i].timestamps
+		values[j] = series[i].values
+		other.total += series[i].total
+	}
+	other.fields = otherLabels(fields, "")
+	other.timestamps, other.values = sumByTime(timestamps, values)
+	return append(result, other)
+}
+
+// zeroFilled returns the series with zero values for the grid buckets missing in the response.
+// Buckets which are not on the grid are moved to the start of their grid step,
+// values of the buckets moved to the same timestamp are summed.
+func (s hitSeries) zeroFilled(grid []time.Time, step time.Duration) hitSeries {
+	byTime := make(map[int64]float64, len(s.timestamps))
+	for i, ts := range s.timestamps {
+		byTime[snapToGrid(ts, grid[0], step).UnixNano()] += s.values[i]
+	}
+
+	filled := hitSeries{
+		fields:     s.fields,
+		total:      s.total,
+		timestamps: make([]time.Time, 0, len(grid)),
+		values:     make([]float64, 0, len(grid)),
+	}
+	for _, ts := range grid {
+		filled.timestamps = append(filled.timestamps, ts)
+		filled.values = append(filled.values, byTime[ts.UnixNano()])
+		delete(byTime, ts.UnixNano())
+	}
+	if len(byTime) == 0 {
+		return filled
+	}
+
+	// buckets outside the query time range
+	for ns, v := range byTime {
+		filled.timestamps = append(filled.timestamps, time.Unix(0, ns))
+		filled.values = append(filled.values, v)
+	}
+	sort.Sort(filled)
+	return filled
+}
+
+// snapToGrid returns the start of the grid step containing ts
+func snapToGrid(ts, first time.Time, step time.Duration) time.Time {
+	d := ts.Sub(first)
+	n := d / step
+	if d%step < 0 {
+		n--
+	}
+	return first.Add(n * step)
+}
+
+// perSecond returns the series with values divided by the step in seconds
+func (s hitSeries) perSecond(step time.Duration) hitSeries {
+	values := make([]float64, len(s.values))
+	for i, v := range s.values {
+		values[i] = v / step.Seconds()
+	}
+	return hitSeries{fields: s.fields, total: s.total, timestamps: s.timestamps, values: values}
+}
+
+func (s hitSeries) Len() int           { return len(s.timestamps) }
+func (s hitSeries) Less(i, j int) bool { return s.timestamps[i].Before(s.timestamps[j]) }
+func (s hitSeries) Swap(i, j int) {
+	s.timestamps[i], s.timestamps[j] = s.timestamps[j], s.timestamps[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+
+// totalFrame returns a single value frame with the total number of hits of the group
+func (s hitSeries) totalFrame() *data.Frame {
+	totalFd := data.NewField(gTotalField, data.Labels(s.fields), []float64{s.total})
+	if len(s.fields) > 0 {
+		if d, err := labelsToJSON(totalFd.Labels); err == nil {
+			totalFd.Config = &data.FieldConfig{DisplayNameFromDS: string(d)}
+		}
+	}
+
+	return data.NewFrame("", totalFd).SetMeta(&data.FrameMeta{
+		Type:        data.FrameTypeNumericMulti,
+		TypeVersion: data.FrameTypeVersion{0, 1},
+	})
+}
@@ -14,12 +14,17 @@ import (
 func Test_parseHitsResponse(t *testing.T) {
 	type opts struct {
 		reader io.Reader
+		query  *Query
 		want   func() backend.DataResponse
 	}
 	f := func(opts opts) {
 		t.Helper()
 		w := opts.want()
-		resp := parseHitsResponse(opts.reader)
+		q := opts.query
+		if q == nil {
+			q = &Query{}
+		}
+		resp := parseHitsResponse(opts.reader, q)
 
 		if w.Error != nil {
 			if w.Error.Error() != resp.Error.Error() {
@@ -68,7 +73,7 @@ func Test_parseHitsResponse(t *testing.T) {
 
 			valueFd.Config = &data.FieldConfig{DisplayNameFromDS: string(d)}
 
-			frame := data.NewFrame("", timeFd, valueFd)
+			frame := data.NewFrame("", timeFd, valueFd).SetMeta(timeSeriesMultiMeta())
 			return backend.DataResponse{Frames: data.Frames{frame}}
 		},
 	}
@@ -90,7 +95,7 @@ func Test_parseHitsResponse(t *testing.T) {
 
 			valueFd1.Config = &data.FieldConfig{DisplayNameFromDS: string(d)}
 
-			frame1 := data.NewFrame("", timeFd1, valueFd1)
+			frame1 := data.NewFrame("", timeFd1, valueFd1).SetMeta(timeSeriesMultiMeta())
 
 			timeFd2 := data.NewFieldFromFieldType(data.FieldTypeTime, 0)
 			timeFd2.Name = gTimeField
@@ -104,7 +109,7 @@ func Test_parseHitsResponse(t *testing.T) {
 
 			valueFd2.Config = &data.FieldConfig{DisplayNameFromDS: string(d)}
 
-			frame2 := data.NewFrame("", timeFd2, valueFd2)
+			frame2 := data.NewFrame("", timeFd2, valueFd2).SetMeta(timeSeriesMultiMeta())
 
 			return backend.DataResponse{Frames: data.Frames{frame1, frame2}}
 		},
@@ -119,4 +124,158 @@ func Test_parseHitsResponse(t *testing.T) {
 		},
 	}
 	f(o)
+
+	timeRange := backend.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC),
+		To:   time.Date(2024, 1, 1, 0, 4, 0, 0, time.UTC),
+	}
+
+	// missing buckets are filled with zeros
+	o = opts{
+		reader: bytes.NewBufferString(`{ "hits": [{ "fields": {}, "timestamps": ["2024-01-01T00:01:00Z", "2024-01-01T00:03:00Z"], "values": [3, 6], "total": 9 }] }`),
+		query:  &Query{DataQuery: backend.DataQuery{TimeRange: timeRange}, step: time.Minute},
+		want: func() backend.DataResponse {
+			timeFd := data.NewField(gTimeField, nil, []time.Time{
+				time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 3, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 4, 0, 0, time.UTC),
+			})
+			valueFd := data.NewField(gValueField, data.Labels{}, []float64{0, 3, 0, 6, 0})
+			return backend.DataResponse{Frames: data.Frames{data.NewFrame("", timeFd, valueFd).SetMeta(timeSeriesMultiMeta())}}
+		},
+	}
+	f(o)
+
+	// off-grid and duplicate buckets are moved to the start of their grid step and summed,
+	// buckets outside the time range are kept
+	o = opts{
+		reader: bytes.NewBufferString(`{ "hits": [{ "fields": {}, "timestamps": ["2024-01-01T00:01:00Z", "2024-01-01T00:02:30Z", "2024-01-01T00:02:45Z", "2024-01-01T00:01:00Z", "2024-01-01T00:06:10Z", "2024-01-01T00:06:20Z"], "values": [1, 2, 3, 4, 5, 6], "total": 21 }] }`),
+		query:  &Query{DataQuery: backend.DataQuery{TimeRange: timeRange}, step: time.Minute},
+		want: func() backend.DataResponse {
+			timeFd := data.NewField(gTimeField, nil, []time.Time{
+				time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 3, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 4, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 0, 6, 0, 0, time.UTC),
+			})
+			valueFd := data.NewField(gValueField, data.Labels{}, []float64{0, 5, 5, 0, 0, 11})
+			return backend.DataResponse{Frames: data.Frames{data.NewFrame("", timeFd, valueFd).SetMeta(timeSeriesMultiMeta())}}
+		},
+	}
+	f(o)
+
+	// buckets are aligned to the timezone offset if there are no timestamps in the response
+	o = opts{
+		reader: bytes.NewBufferString(`{ "hits": [{ "fields": {}, "timestamps": [], "values": [] }] }`),
+		query: &Query{
+			DataQuery: backend.DataQuery{TimeRange: backend.TimeRange{
+				From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			}},
+			step:   24 * time.Hour,
+			offset: 2 * time.Hour,
+		},
+		want: func() backend.DataResponse {
+			timeFd := data.NewField(gTimeField, nil, []time.Time{
+				time.Date(2023, 12, 31, 22, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC),
+			})
+			valueFd := data.NewField(gValueField, data.Labels{}, []float64{0, 0})
+			return backend.DataResponse{Frames: data.Frames{data.NewFrame("", timeFd, valueFd).SetMeta(timeSeriesMultiMeta())}}
+		},
+	}
+	f(o)
+
+	// per second normalization and totals frames
+	o = opts{
+		reader: bytes.NewBufferString(`{ "hits": [{ "fields": { "level": "error" }, "timestamps": ["2024-01-01T00:01:00Z", "2024-01-01T00:02:00Z"], "values": [30, 120], "total": 150 }, { "fields": { "level": "info" }, "timestamps": ["2024-01-01T00:01:00Z"], "values": [60] }] }`),
+		query:  &Query{Normalize: normalizePerSecond, HitsTotals: true, step: time.Minute},
+		want: func() backend.DataResponse {
+			errLabels := data.Labels{"level": "error"}
+			errJSON, _ := labelsToJSON(errLabels)
+			infoLabels := data.Labels{"level": "info"}
+			infoJSON, _ := labelsToJSON(infoLabels)
+
+			errValues := data.NewField(gValueField, errLabels, []float64{0.5, 2})
+			errValues.Config = &data.FieldConfig{DisplayNameFromDS: string(errJSON)}
+			errFrame := data.NewFrame("",
+				data.NewField(gTimeField, nil, []time.Time{
+					time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC),
+					time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC),
+				}),
+				errValues).SetMeta(timeSeriesMultiMeta())
+
+			infoValues := data.NewField(gValueField, infoLabels, []float64{1})
+			infoValues.Config = &data.FieldConfig{DisplayNameFromDS: string(infoJSON)}
+			infoFrame := data.NewFrame("",
+				data.NewField(gTimeField, nil, []time.Time{time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)}),
+				infoValues).SetMeta(timeSeriesMultiMeta())
+
+			meta := &data.FrameMeta{Type: data.FrameTypeNumericMulti, TypeVersion: data.FrameTypeVersion{0, 1}}
+			errTotal := data.NewField(gTotalField, errLabels, []float64{150})
+			errTotal.Config = &data.FieldConfig{DisplayNameFromDS: string(errJSON)}
+			infoTotal := data.NewField(gTotalField, infoLabels, []float64{60})
+			infoTotal.Config = &data.FieldConfig{DisplayNameFromDS: string(infoJSON)}
+
+			return backend.DataResponse{Frames: data.Frames{
+				errFrame,
+				infoFrame,
+				data.NewFrame("", errTotal).SetMeta(meta),
+				data.NewFrame("", infoTotal).SetMeta(meta),
+			}}
+		},
+	}
+	f(o)
+
+	// top N series with the rest summed into the other series
+	o = opts{
+		reader: bytes.NewBufferString(`{ "hits": [{ "fields": { "host": "a" }, "timestamps": ["2024-01-01T00:01:00Z"], "values": [1], "total": 1 }, { "fields": { "host": "b" }, "timestamps": ["2024-01-01T00:01:00Z"], "values": [10], "total": 10 }, { "fields": { "host": "c" }, "timestamps": ["2024-01-01T00:01:00Z", "2024-01-01T00:02:00Z"], "values": [2, 3], "total": 5 }] }`),
+		query:  &Query{TopN: 1},
+		want: func() backend.DataResponse {
+			topLabels := data.Labels{"host": "b"}
+			topJSON, _ := labelsToJSON(topLabels)
+			otherLabels := data.Labels{"host": otherSeriesValue}
+			otherJSON, _ := labelsToJSON(otherLabels)
+
+			topValues := data.NewField(gValueField, topLabels, []float64{10})
+			topValues.Config = &data.FieldConfig{DisplayNameFromDS: string(topJSON)}
+			otherValues := data.NewField(gValueField, otherLabels, []float64{3, 3})
+			otherValues.Config = &data.FieldConfig{DisplayNameFromDS: string(otherJSON)}
+
+			return backend.DataResponse{Frames: data.Frames{
+				data.NewFrame("",
+					data.NewField(gTimeField, nil, []time.Time{time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)}),
+					topValues).SetMeta(timeSeriesMultiMeta()),
+				data.NewFrame("",
+					data.NewField(gTimeField, nil, []time.Time{
+						time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC),
+						time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC),
+					}),
+					otherValues).SetMeta(timeSeriesMultiMeta()),
+			}}
+		},
+	}
+	f(o)
+	// alerting reduces every group to the total number of hits
+	o = opts{
+		reader: bytes.NewBufferString(`{ "hits": [{ "fields": { "host": "a" }, "timestamps": ["2024-01-01T00:01:00Z", "2024-01-01T00:02:00Z"], "values": [1, 2], "total": 3 }, { "fields": {}, "timestamps": ["2024-01-01T00:01:00Z"], "values": [4] }] }`),
+		query:  &Query{ForAlerting: true},
+		want: func() backend.DataResponse {
+			labels := data.Labels{"host": "a"}
+			labelsJSON, _ := labelsToJSON(labels)
+			totalA := data.NewField(gTotalField, labels, []float64{3})
+			totalA.Config = &data.FieldConfig{DisplayNameFromDS: string(labelsJSON)}
+			meta := &data.FrameMeta{Type: data.FrameTypeNumericMulti, TypeVersion: data.FrameTypeVersion{0, 1}}
+
+			return backend.DataResponse{Frames: data.Frames{
+				data.NewFrame("", totalA).SetMeta(meta),
+				data.NewFrame("", data.NewField(gTotalField, data.Labels{}, []float64{4})).SetMeta(meta),
+			}}
+		},
+	}
+	f(o)
 }
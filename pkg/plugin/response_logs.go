@@ -160,39 +160,8 @@ func getLogRow(value *fastjson.Value) (logRow, error) {
 // fields and frame with necessary information
 func parseInstantResponse(reader io.Reader) backend.DataResponse {
 	frame := newLogFrame()
-	br := bufio.NewReaderSize(reader, 64*1024)
-	var parser fastjson.Parser
-	var finishedReading bool
-	for n := 0; !finishedReading; n++ {
-		b, err := br.ReadBytes('\n')
-		if err != nil {
-			if errors.Is(err, bufio.ErrBufferFull) {
-				backend.Logger.Debug("skipping line number: line too long", "lineNumber", n)
-				continue
-			}
-			if errors.Is(err, io.EOF) {
-				// b can be != nil when EOF is returned, so we need to process it
-				finishedReading = true
-			} else {
-				return newResponseError(fmt.Errorf("cannot read line in response: %s", err), backend.StatusInternal)
-			}
-		}
-
-		if len(b) == 0 {
-			continue
-		}
-
-		value, err := parseJsonLine(&parser, b)
-		if err != nil {
-			return newResponseError(err, backend.StatusInternal)
-		}
-
-		row, err := getLogRow(value)
-		if err != nil {
-			return newResponseError(err, backend.StatusInternal)
-		}
-
-		frame.append(row)
+	if err := readLogRows(reader, frame.append); err != nil {
+		return newResponseError(err, backend.StatusInternal)
 	}
 
 	rsp := backend.DataResponse{}
@@ -208,17 +177,12 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 	return rsp
 }
 
-// parseStreamResponse reads data from the reader and collects
-// fields and frame with necessary information
-// it looks like the parseInstantResponse function, but it reads data and continuously
-// parse the lines from the reader and we need to collect only one data.Frame
-func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
+// readLogRows reads log entries line by line from the reader and passes them to fn
+func readLogRows(reader io.Reader, fn func(logRow)) error {
 	br := bufio.NewReaderSize(reader, 64*1024)
 	var parser fastjson.Parser
 	var finishedReading bool
 	for n := 0; !finishedReading; n++ {
-		frame := newLogFrame()
-
 		b, err := br.ReadBytes('\n')
 		if err != nil {
 			if errors.Is(err, bufio.ErrBufferFull) {
@@ -247,18 +211,97 @@ func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
 			return err
 		}
 
-		frame.append(row)
-		// this is necessary information because the logs visualization is preferred
-		frame.dataFrame.Meta = &data.FrameMeta{
-			PreferredVisualization: logsVisualisation,
-			Custom: map[string]any{
-				"streamIds": frame.streamIds,
-				"streams":   frame.streams,
-			},
+		fn(row)
+	}
+	return nil
+}
+
+// parseLogsAlertingResponse parses the number of logs matched by the raw logs query in alerts.
+// With the presence alert value, every positive count is replaced with 1.
+func parseLogsAlertingResponse(reader io.Reader, q *Query) backend.DataResponse {
+	resp := parseStatsResponse(reader, q)
+	if resp.Error != nil || q.AlertValue != alertValuePresence {
+		return resp
+	}
+
+	for _, frame := range resp.Frames {
+		for _, fd := range frame.Fields {
+			if fd.Type() != data.FieldTypeFloat64 {
+				continue
+			}
+			for i := 0; i < fd.Len(); i++ {
+				if v, ok := fd.At(i).(float64); ok && v > 0 {
+					fd.Set(i, float64(1))
+				}
+			}
 		}
+	}
+	return resp
+}
+
+// streamFrame returns the data frame with the meta required by the live logs view
+func (b *logFrame) streamFrame() *data.Frame {
+	// this is necessary information because the logs visualization is preferred
+	b.dataFrame.Meta = &data.FrameMeta{
+		PreferredVisualization: logsVisualisation,
+		Custom: map[string]any{
+			"streamIds": b.streamIds,
+			"streams":   b.streams,
+		},
+	}
+	return b.dataFrame
+}
+
+// tailBatch limits the number of tailed rows per frame
+// and how long the rows are buffered before they are sent
+type tailBatch struct {
+	maxRows       int
+	flushInterval time.Duration
+}
+
+// parseStreamResponse reads data from the reader and sends tailed rows
+// to the channel in frames of up to batch.maxRows rows.
+// Incomplete frames are sent every batch.flushInterval.
+// Rows already delivered according to the cursor are skipped.
+func parseStreamResponse(reader io.Reader, ch chan *data.Frame, batch tailBatch, cursor *tailCursor) error {
+	rows := make(chan logRow, batch.maxRows)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- readLogRows(reader, func(row logRow) {
+			rows <- row
+		})
+		close(rows)
+	}()
+
+	ticker := time.NewTicker(batch.flushInterval)
+	defer ticker.Stop()
 
-		ch <- frame.dataFrame
+	frame := newLogFrame()
+	flush := func() {
+		if len(frame.streamIds) == 0 {
+			return
+		}
+		ch <- frame.streamFrame()
+		frame = newLogFrame()
+		cursor.prune()
 	}
 
-	return nil
+	for {
+		select {
+		case row, ok := <-rows:
+			if !ok {
+				flush()
+				return <-errCh
+			}
+			if !cursor.add(row) {
+				continue
+			}
+			frame.append(row)
+			if len(frame.streamIds) >= batch.maxRows {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
 }
@@ -628,3 +628,136 @@ func Test_parseInstantResponse(t *testing.T) {
 	}
 	f(o)
 }
+
+func Test_parseLogsAlertingResponse(t *testing.T) {
+	type opts struct {
+		response   string
+		alertValue string
+		want       float64
+	}
+	f := func(opts opts) {
+		t.Helper()
+		q := &Query{ForAlerting: true, AlertValue: opts.alertValue}
+		resp := parseLogsAlertingResponse(bytes.NewBufferString(opts.response), q)
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		}
+
+		frame := data.NewFrame("",
+			data.NewField(alertLogsCountName, data.Labels{"__name__": alertLogsCountName}, []float64{opts.want})).
+			SetMeta(&data.FrameMeta{
+				Type:        data.FrameTypeNumericMulti,
+				TypeVersion: data.FrameTypeVersion{0, 1},
+			})
+		want, err := backend.DataResponse{Frames: data.Frames{frame}}.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal want response: %s", err)
+		}
+		got, err := resp.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal response: %s", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("\n got value: %s, \n want value: %s", got, want)
+		}
+	}
+
+	countResponse := func(count string) string {
+		return fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"logs"},"value":[1704067200,%q]}]}}`, count)
+	}
+
+	// number of matched logs by default
+	o := opts{
+		response: countResponse("42"),
+		want:     42,
+	}
+	f(o)
+
+	// presence of matched logs
+	o = opts{
+		response:   countResponse("42"),
+		alertValue: alertValuePresence,
+		want:       1,
+	}
+	f(o)
+
+	// no matched logs
+	o = opts{
+		response:   countResponse("0"),
+		alertValue: alertValuePresence,
+		want:       0,
+	}
+	f(o)
+}
+
+func Test_parseStreamResponse(t *testing.T) {
+	type opts struct {
+		rows  int
+		batch tailBatch
+		want  []int
+	}
+	f := func(opts opts) {
+		t.Helper()
+		var sb strings.Builder
+		for i := 0; i < opts.rows; i++ {
+			fmt.Fprintf(&sb, `{"_time":"2024-01-01T00:00:%02dZ","_msg":"line %d","_stream":"{app=\"api\"}"}`+"\n", i%60, i)
+		}
+
+		ch := make(chan *data.Frame, opts.rows+1)
+		if err := parseStreamResponse(strings.NewReader(sb.String()), ch, opts.batch, newTailCursor()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		close(ch)
+
+		var got []int
+		for frame := range ch {
+			got = append(got, frame.Rows())
+			if frame.Meta == nil || frame.Meta.PreferredVisualization != logsVisualisation {
+				t.Fatalf("expected logs visualisation meta, got %v", frame.Meta)
+			}
+		}
+		if !reflect.DeepEqual(got, opts.want) {
+			t.Fatalf("unexpected frame sizes: got %v, want %v", got, opts.want)
+		}
+	}
+
+	// rows are split into frames of the max size
+	o := opts{
+		rows:  250,
+		batch: tailBatch{maxRows: 100, flushInterval: time.Hour},
+		want:  []int{100, 100, 50},
+	}
+	f(o)
+
+	// no rows
+	o = opts{
+		rows:  0,
+		batch: tailBatch{maxRows: 100, flushInterval: time.Hour},
+		want:  nil,
+	}
+	f(o)
+}
+
+func Test_parseStreamResponseFlushInterval(t *testing.T) {
+	pr, pw := io.Pipe()
+	ch := make(chan *data.Frame, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- parseStreamResponse(pr, ch, tailBatch{maxRows: 100, flushInterval: 10 * time.Millisecond}, newTailCursor())
+	}()
+
+	_, _ = pw.Write([]byte(`{"_time":"2024-01-01T00:00:00Z","_msg":"first"}` + "\n"))
+	select {
+	case frame := <-ch:
+		if frame.Rows() != 1 {
+			t.Fatalf("expected 1 row, got %d", frame.Rows())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("incomplete frame wasn't flushed")
+	}
+
+	_ = pw.Close()
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
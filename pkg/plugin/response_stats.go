@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -21,13 +23,16 @@ func parseStatsResponse(reader io.Reader, q *Query) backend.DataResponse {
 	}
 	rs.ForAlerting = q.ForAlerting
 
-	frames, err := rs.getDataFrames()
+	frames, err := rs.getDataFrames(q)
 	if err != nil {
 		err = fmt.Errorf("failed to prepare data from response: %w", err)
 		return newResponseError(err, backend.StatusInternal)
 	}
 
 	for i := range frames {
+		if isTableFrame(frames[i]) {
+			continue
+		}
 		q.addMetadataToMultiFrame(frames[i])
 		q.addIntervalToFrame(frames[i])
 	}
@@ -73,9 +78,11 @@ func (ls logStats) vectorDataFrames() (data.Frames, error) {
 			return nil, fmt.Errorf("failed to parse float value for metric %v: %w", res, err)
 		}
 
+		// the frame isn't typed as numeric-multi, since the time field is required
+		// by the table view of instant queries, but isn't allowed by the numeric dataplane types
 		frames[i] = data.NewFrame("",
 			data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{ts}),
-			data.NewField(data.TimeSeriesValueFieldName, data.Labels(res.Labels), []*float64{valuePtr}))
+			data.NewField(statsValueFieldName(res.Labels), data.Labels(res.Labels), []*float64{valuePtr}))
 	}
 
 	return frames, nil
@@ -84,13 +91,17 @@ func (ls logStats) vectorDataFrames() (data.Frames, error) {
 func (ls logStats) alertingDataFrames() (data.Frames, error) {
 	frames := make(data.Frames, len(ls.Result))
 	for i, res := range ls.Result {
-		f, err := strconv.ParseFloat(res.Value[1].(string), 64)
+		valuePtr, err := getFloatPtr(res.Value[1])
 		if err != nil {
-			return nil, fmt.Errorf("metric %v, unable to parse timestamp to float64 from %s: %w", res, res.Value[1], err)
+			return nil, fmt.Errorf("metric %v, unable to parse value to float64: %w", res, err)
+		}
+		if valuePtr == nil {
+			return nil, fmt.Errorf("metric %v, unable to parse value to float64 from empty string", res)
 		}
+		f := *valuePtr
 
 		frames[i] = data.NewFrame("",
-			data.NewField(data.TimeSeriesValueFieldName, data.Labels(res.Labels), []float64{f})).
+			data.NewField(statsValueFieldName(res.Labels), data.Labels(res.Labels), []float64{f})).
 			// to show instant alert response with the table we need to define the type of the frame
 			// and it should be [0, 1] like it set in the Grafana
 			SetMeta(&data.FrameMeta{
@@ -102,9 +113,23 @@ func (ls logStats) alertingDataFrames() (data.Frames, error) {
 	return frames, nil
 }
 
-func (ls logStats) matrixDataFrames() (data.Frames, error) {
-	frames := make(data.Frames, len(ls.Result))
-	for i, res := range ls.Result {
+// matrixSeries contains parsed timestamps and values of a single range series
+type matrixSeries struct {
+	labels     Labels
+	timestamps []time.Time
+	values     []*float64
+}
+
+func (ls logStats) matrixDataFrames(q *Query) (data.Frames, error) {
+	series := make([]matrixSeries, 0, len(ls.Result))
+	var skipped int
+	for _, res := range ls.Result {
+		if len(res.Values) < 1 {
+			// a single empty series shouldn't fail the whole response
+			skipped++
+			continue
+		}
+
 		timestamps := make([]time.Time, len(res.Values))
 		values := make([]*float64, len(res.Values))
 
@@ -122,32 +147,398 @@ func (ls logStats) matrixDataFrames() (data.Frames, error) {
 			values[j] = fPtr
 		}
 
-		if len(values) < 1 || len(timestamps) < 1 {
-			return nil, fmt.Errorf("log %v contains no values", res)
+		s := matrixSeries{labels: res.Labels, timestamps: timestamps, values: values}
+		if q.step > 0 {
+			s = s.aligned(q.step, q.offset)
 		}
+		series = append(series, s)
+	}
 
+	if q.TopN > 0 {
+		series = topNMatrix(series, q.TopN)
+	}
+
+	var grid []time.Time
+	switch q.Fill {
+	case fillNull, fillZero, fillPrevious:
+		grid = q.stepGrid(time.Time{})
+	}
+
+	frames := make(data.Frames, len(series))
+	for i, s := range series {
+		if grid != nil {
+			s = s.filled(grid, q.Fill)
+		}
 		frames[i] = data.NewFrame("",
-			data.NewField(data.TimeSeriesTimeFieldName, nil, timestamps),
-			data.NewField(data.TimeSeriesValueFieldName, data.Labels(res.Labels), values))
+			data.NewField(data.TimeSeriesTimeFieldName, nil, s.timestamps),
+			data.NewField(statsValueFieldName(s.labels), data.Labels(s.labels), s.values)).
+			SetMeta(timeSeriesMultiMeta())
+	}
+
+	if skipped > 0 {
+		notice := data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d series without values were skipped", skipped),
+		}
+		if len(frames) == 0 {
+			frames = append(frames, data.NewFrame("").SetMeta(timeSeriesMultiMeta()))
+		}
+		frames[0].AppendNotices(notice)
 	}
 
 	return frames, nil
 }
 
-func (r *Response) getDataFrames() (data.Frames, error) {
+// aligned returns the series with timestamps moved to the start of their step buckets,
+// so series of stacked charts line up. The last value wins if several points fall into one bucket.
+func (s matrixSeries) aligned(step, offset time.Duration) matrixSeries {
+	result := matrixSeries{
+		labels:     s.labels,
+		timestamps: make([]time.Time, 0, len(s.timestamps)),
+		values:     make([]*float64, 0, len(s.values)),
+	}
+	for i, ts := range s.timestamps {
+		ts = utils.AlignTime(ts, step, offset)
+		if n := len(result.timestamps); n > 0 && result.timestamps[n-1].Equal(ts) {
+			result.values[n-1] = s.values[i]
+			continue
+		}
+		result.timestamps = append(result.timestamps, ts)
+		result.values = append(result.values, s.values[i])
+	}
+	return result
+}
+
+// filled returns the series with a point for every step of the grid.
+// Missing points are set according to the fill policy; points outside the grid are kept.
+func (s matrixSeries) filled(grid []time.Time, policy string) matrixSeries {
+	byTime := make(map[int64]*float64, len(s.timestamps))
+	for i, ts := range s.timestamps {
+		byTime[ts.UnixNano()] = s.values[i]
+	}
+
+	all := make([]time.Time, 0, len(grid)+len(s.timestamps))
+	all = append(all, grid...)
+	onGrid := make(map[int64]struct{}, len(grid))
+	for _, ts := range grid {
+		onGrid[ts.UnixNano()] = struct{}{}
+	}
+	for _, ts := range s.timestamps {
+		if _, ok := onGrid[ts.UnixNano()]; !ok {
+			all = append(all, ts)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Before(all[j]) })
+
+	result := matrixSeries{
+		labels:     s.labels,
+		timestamps: all,
+		values:     make([]*float64, len(all)),
+	}
+	var prev *float64
+	for i, ts := range all {
+		v, ok := byTime[ts.UnixNano()]
+		if !ok {
+			switch policy {
+			case fillZero:
+				v = utils.Ptr(float64(0))
+			case fillPrevious:
+				v = prev
+			}
+		}
+		if v != nil {
+			prev = v
+		}
+		result.values[i] = v
+	}
+	return result
+}
+
+// topNMatrix keeps n series with the largest totals for every stats result
+// and sums the rest of them into a single series with otherSeriesValue labels
+func topNMatrix(series []matrixSeries, n int) []matrixSeries {
+	// series of different stats functions can't be compared or merged,
+	// so they are limited separately keeping the order of the first appearance
+	var names []string
+	groups := make(map[string][]matrixSeries)
+	for _, s := range series {
+		name := s.labels[metricsName]
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], s)
+	}
+
+	var result []matrixSeries
+	for _, name := range names {
+		group := groups[name]
+		totals := make([]float64, len(group))
+		for i, s := range group {
+			for _, v := range s.values {
+				if v != nil {
+					totals[i] += *v
+				}
+			}
+		}
+		top, rest := splitTopN(totals, n)
+		for _, i := range top {
+			result = append(result, group[i])
+		}
+		if len(rest) == 0 {
+			continue
+		}
+
+		labels := make([]map[string]string, len(rest))
+		timestamps := make([][]time.Time, len(rest))
+		values := make([][]float64, len(rest))
+		for j, i := range rest {
+			labels[j] = group[i].labels
+			for k, v := range group[i].values {
+				if v == nil {
+					continue
+				}
+				timestamps[j] = append(timestamps[j], group[i].timestamps[k])
+				values[j] = append(values[j], *v)
+			}
+		}
+		ts, vs := sumByTime(timestamps, values)
+		other := matrixSeries{
+			labels:     otherLabels(labels, metricsName),
+			timestamps: ts,
+			values:     make([]*float64, len(vs)),
+		}
+		for i := range vs {
+			other.values[i] = utils.Ptr(vs[i])
+		}
+		result = append(result, other)
+	}
+	return result
+}
+
+// splitNonNumeric splits the results into the ones with numeric values only
+// and the ones containing a value which isn't a number.
+// Such values are returned by stats functions like `uniq_values`, `row_any`, `values` or `json_values`.
+func (ls logStats) splitNonNumeric(resultType string) (logStats, logStats) {
+	var numeric, nonNumeric logStats
+	for _, res := range ls.Result {
+		if isNumericResult(resultType, res) {
+			numeric.Result = append(numeric.Result, res)
+		} else {
+			nonNumeric.Result = append(nonNumeric.Result, res)
+		}
+	}
+	return numeric, nonNumeric
+}
+
+func isNumericResult(resultType string, res Result) bool {
+	switch resultType {
+	case vector:
+		return isNumericValue(res.Value[1])
+	case matrix:
+		for _, v := range res.Values {
+			if !isNumericValue(v[1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// resultNames returns the sorted unique stats result names
+func (ls logStats) resultNames() []string {
+	nameSet := make(map[string]struct{})
+	for _, res := range ls.Result {
+		nameSet[res.Labels[metricsName]] = struct{}{}
+	}
+	names := make([]string, 0, len(nameSet))
+	for k := range nameSet {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tableDataFrames returns the results as a single table frame
+// with a column per label, a row per point and the value as string or JSON
+func (ls logStats) tableDataFrames(resultType string) (data.Frames, error) {
+	nameSet := make(map[string]struct{})
+	for _, res := range ls.Result {
+		for k := range res.Labels {
+			nameSet[k] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(nameSet))
+	for k := range nameSet {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, 0)
+	timeFd.Name = gTimeField
+	labelFds := make([]*data.Field, len(names))
+	for i, name := range names {
+		labelFds[i] = data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		labelFds[i].Name = name
+	}
+	valueFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+	valueFd.Name = gValueField
+
+	appendRow := func(res Result, value Value) error {
+		ts, err := getTimestamp(value[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse timestamp for metric %v: %w", res, err)
+		}
+		v, err := valueToString(value[1])
+		if err != nil {
+			return fmt.Errorf("failed to convert value for metric %v: %w", res, err)
+		}
+		timeFd.Append(ts)
+		for i, name := range names {
+			labelFds[i].Append(res.Labels[name])
+		}
+		valueFd.Append(v)
+		return nil
+	}
+
+	for _, res := range ls.Result {
+		if resultType == vector {
+			if err := appendRow(res, res.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, value := range res.Values {
+			if err := appendRow(res, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fields := append([]*data.Field{timeFd}, labelFds...)
+	fields = append(fields, valueFd)
+	frame := data.NewFrame("", fields...).SetMeta(&data.FrameMeta{
+		Type:                   data.FrameTypeTable,
+		PreferredVisualization: data.VisTypeTable,
+	})
+	return data.Frames{frame}, nil
+}
+
+// numericWideDataFrames returns instant results as a single numeric wide dataplane frame:
+// a single row with a value field per result, labels of the result are set on the field.
+// Reduce and SQL expressions consume it directly.
+func (ls logStats) numericWideDataFrames() (data.Frames, error) {
+	fields := make([]*data.Field, 0, len(ls.Result))
+	for _, res := range ls.Result {
+		valuePtr, err := getFloatPtr(res.Value[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse float value for metric %v: %w", res, err)
+		}
+		fields = append(fields, data.NewField(statsValueFieldName(res.Labels), dimensionLabels(res.Labels), []*float64{valuePtr}))
+	}
+
+	frame := data.NewFrame("", fields...).SetMeta(&data.FrameMeta{
+		Type:                   data.FrameTypeNumericWide,
+		TypeVersion:            data.FrameTypeVersion{0, 1},
+		PreferredVisualization: data.VisTypeTable,
+	})
+	return data.Frames{frame}, nil
+}
+
+// statsValueFieldName returns the stats result name for the value field,
+// e.g. `count(*)`, or the default value field name if the result name is missing
+func statsValueFieldName(labels Labels) string {
+	if name := labels[metricsName]; name != "" {
+		return name
+	}
+	return data.TimeSeriesValueFieldName
+}
+
+// timeSeriesMultiMeta returns the meta of the time series frame with a single value field
+func timeSeriesMultiMeta() *data.FrameMeta {
+	return &data.FrameMeta{
+		Type:        data.FrameTypeTimeSeriesMulti,
+		TypeVersion: data.FrameTypeVersion{0, 1},
+	}
+}
+
+// dimensionLabels returns labels without the stats result name
+func dimensionLabels(labels Labels) data.Labels {
+	result := make(data.Labels, len(labels))
+	for k, v := range labels {
+		if k != metricsName {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// isTableFrame checks whether the frame is a table or heatmap which doesn't need series metadata
+func isTableFrame(frame *data.Frame) bool {
+	if frame.Meta == nil {
+		return false
+	}
+	switch frame.Meta.Type {
+	case data.FrameTypeTable, data.FrameTypeNumericWide, frameTypeHeatmapCells:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Response) getDataFrames(q *Query) (data.Frames, error) {
 	var ls logStats
 	if err := json.Unmarshal(r.Data.Result, &ls.Result); err != nil {
 		return nil, fmt.Errorf("unmarshal err %s; \n %#v", err, string(r.Data.Result))
 	}
 
+	var nonNumeric logStats
+	switch r.Data.ResultType {
+	case vector, matrix:
+		ls, nonNumeric = ls.splitNonNumeric(r.Data.ResultType)
+	}
+	if len(nonNumeric.Result) == 0 {
+		return ls.numericDataFrames(r, q)
+	}
+	if r.ForAlerting {
+		return nil, fmt.Errorf("alerting queries require numeric stats results, got non-numeric values for %s", strings.Join(nonNumeric.resultNames(), ", "))
+	}
+
+	// only the non-numeric results are returned as a table,
+	// the numeric ones keep their usual frames
+	tableFrames, err := nonNumeric.tableDataFrames(r.Data.ResultType)
+	if err != nil {
+		return nil, err
+	}
+	if len(ls.Result) == 0 {
+		return tableFrames, nil
+	}
+	frames, err := ls.numericDataFrames(r, q)
+	if err != nil {
+		return nil, err
+	}
+	return append(frames, tableFrames...), nil
+}
+
+// numericDataFrames returns the frames for results with numeric values in the requested format
+func (ls logStats) numericDataFrames(r *Response, q *Query) (data.Frames, error) {
+	switch r.Data.ResultType {
+	case vector, matrix:
+		if q.Format == formatHistogram {
+			return ls.heatmapDataFrames(r.Data.ResultType, q)
+		}
+	}
+
 	switch r.Data.ResultType {
 	case vector:
+		if q.Format == formatTable {
+			return ls.numericWideDataFrames()
+		}
 		if r.ForAlerting {
 			return ls.alertingDataFrames()
 		}
 		return ls.vectorDataFrames()
 	case matrix:
-		return ls.matrixDataFrames()
+		return ls.matrixDataFrames(q)
 	default:
 		return nil, fmt.Errorf("unknown result type %q", r.Data.ResultType)
 	}
@@ -166,6 +557,9 @@ func getTimestamp(value interface{}) (time.Time, error) {
 }
 
 func getFloatPtr(value interface{}) (*float64, error) {
+	if value == nil {
+		return nil, nil
+	}
 	f, ok := value.(string)
 	if !ok {
 		return nil, fmt.Errorf("unable to convert log value to string from %v", value)
@@ -183,3 +577,31 @@ func getFloatPtr(value interface{}) (*float64, error) {
 	floatPtr := utils.Ptr(flVal)
 	return floatPtr, nil
 }
+
+// isNumericValue checks whether the stats value is a number or an empty value
+func isNumericValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	if s == "" {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// valueToString returns string values as is and any other value as JSON
+func valueToString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
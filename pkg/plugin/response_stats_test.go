@@ -107,11 +107,11 @@ func Test_getStatsResponse(t *testing.T) {
 			frames := []*data.Frame{
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1730937600, 0)}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": "message"}, []*float64{utils.Ptr(float64(13377))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": "message"}, []*float64{utils.Ptr(float64(13377))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
 				),
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1730937600, 0)}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": ""}, []*float64{utils.Ptr(float64(2078793288))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": ""}, []*float64{utils.Ptr(float64(2078793288))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
 				),
 			}
 
@@ -135,8 +135,8 @@ func Test_getStatsResponse(t *testing.T) {
 			frames := []*data.Frame{
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1704067200, 0), time.Unix(1704088800, 0), time.Unix(1704110400, 0), time.Unix(1704132000, 0)}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": ""}, []*float64{utils.Ptr(float64(1311461)), utils.Ptr(float64(1311601)), utils.Ptr(float64(1310266)), utils.Ptr(float64(1310875))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
-				),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": ""}, []*float64{utils.Ptr(float64(1311461)), utils.Ptr(float64(1311601)), utils.Ptr(float64(1310266)), utils.Ptr(float64(1310875))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+				).SetMeta(timeSeriesMultiMeta()),
 			}
 
 			rsp := backend.DataResponse{}
@@ -163,8 +163,8 @@ func Test_getStatsResponse(t *testing.T) {
 						time.Unix(1733187134, 0),
 						time.Unix(1733187134, 449999809),
 					}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)"}, []*float64{utils.Ptr(float64(58)), utils.Ptr(float64(1))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
-				),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)"}, []*float64{utils.Ptr(float64(58)), utils.Ptr(float64(1))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+				).SetMeta(timeSeriesMultiMeta()),
 			}
 			rsp := backend.DataResponse{}
 			rsp.Frames = append(rsp.Frames, frames...)
@@ -186,10 +186,10 @@ func Test_getStatsResponse(t *testing.T) {
 		want: func() backend.DataResponse {
 			frames := []*data.Frame{
 				data.NewFrame("",
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": "message"}, []float64{13377}),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": "message"}, []float64{13377}),
 				).SetMeta(&data.FrameMeta{Type: data.FrameTypeNumericMulti, TypeVersion: data.FrameTypeVersion{0, 1}}),
 				data.NewFrame("",
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": ""}, []float64{2078793288}),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": ""}, []float64{2078793288}),
 				).SetMeta(&data.FrameMeta{Type: data.FrameTypeNumericMulti, TypeVersion: data.FrameTypeVersion{0, 1}}),
 			}
 
@@ -214,11 +214,11 @@ func Test_getStatsResponse(t *testing.T) {
 			frames := []*data.Frame{
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1730937600, 0)}).SetConfig(&data.FieldConfig{Interval: 1000}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": "message"}, []*float64{utils.Ptr(float64(13377))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": "message"}, []*float64{utils.Ptr(float64(13377))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
 				),
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1730937600, 0)}).SetConfig(&data.FieldConfig{Interval: 1000}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "count(*)", "type": ""}, []*float64{utils.Ptr(float64(2078793288))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+					data.NewField("count(*)", data.Labels{"__name__": "count(*)", "type": ""}, []*float64{utils.Ptr(float64(2078793288))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
 				),
 			}
 
@@ -242,7 +242,7 @@ func Test_getStatsResponse(t *testing.T) {
 			frames := []*data.Frame{
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1756992432, 0)}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "p95"}, []*float64{nil}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+					data.NewField("p95", data.Labels{"__name__": "p95"}, []*float64{nil}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
 				),
 			}
 
@@ -266,7 +266,7 @@ func Test_getStatsResponse(t *testing.T) {
 			frames := []*data.Frame{
 				data.NewFrame("legend ",
 					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1756992432, 0)}),
-					data.NewField(data.TimeSeriesValueFieldName, data.Labels{"__name__": "p95"}, []*float64{nil}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
+					data.NewField("p95", data.Labels{"__name__": "p95"}, []*float64{nil}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend "}),
 				),
 			}
 
@@ -276,4 +276,211 @@ func Test_getStatsResponse(t *testing.T) {
 		},
 	}
 	f(o)
+
+	// top N range series with the rest summed into the other series
+	o = opts{
+		filename: "test-data/stats_range_response_many_series",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			TopN: 1,
+		},
+		want: func() backend.DataResponse {
+			top := data.Labels{"__name__": "count(*)", "host": "b"}
+			other := data.Labels{"__name__": "count(*)", "host": otherSeriesValue}
+			frames := []*data.Frame{
+				data.NewFrame(labelsToString(top),
+					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1704067200, 0), time.Unix(1704088800, 0)}),
+					data.NewField("count(*)", top, []*float64{utils.Ptr(float64(10)), utils.Ptr(float64(20))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: labelsToString(top)}),
+				).SetMeta(timeSeriesMultiMeta()),
+				data.NewFrame(labelsToString(other),
+					data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1704067200, 0), time.Unix(1704088800, 0)}),
+					data.NewField("count(*)", other, []*float64{utils.Ptr(float64(1)), utils.Ptr(float64(6))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: labelsToString(other)}),
+				).SetMeta(timeSeriesMultiMeta()),
+			}
+
+			rsp := backend.DataResponse{}
+			rsp.Frames = append(rsp.Frames, frames...)
+			return rsp
+		},
+	}
+	f(o)
+
+	// sparse range series are aligned to the step and filled, empty series are skipped with a notice
+	fillQuery := func(fill string) *Query {
+		return &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+				TimeRange: backend.TimeRange{
+					From: time.Unix(1704067200, 0),
+					To:   time.Unix(1704067380, 0),
+				},
+			},
+			Fill: fill,
+			step: time.Minute,
+		}
+	}
+	fillWant := func(values []*float64) func() backend.DataResponse {
+		return func() backend.DataResponse {
+			labels := data.Labels{"__name__": "count(*)", "host": "a"}
+			frame := data.NewFrame(labelsToString(labels),
+				data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{time.Unix(1704067200, 0), time.Unix(1704067260, 0), time.Unix(1704067320, 0), time.Unix(1704067380, 0)}),
+				data.NewField("count(*)", labels, values).SetConfig(&data.FieldConfig{DisplayNameFromDS: labelsToString(labels)}),
+			).SetMeta(timeSeriesMultiMeta())
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: "1 series without values were skipped"})
+			return backend.DataResponse{Frames: data.Frames{frame}}
+		}
+	}
+
+	o = opts{
+		filename: "test-data/stats_range_response_sparse",
+		q:        fillQuery(fillNull),
+		want:     fillWant([]*float64{utils.Ptr(float64(1)), nil, utils.Ptr(float64(3)), nil}),
+	}
+	f(o)
+
+	o = opts{
+		filename: "test-data/stats_range_response_sparse",
+		q:        fillQuery(fillZero),
+		want:     fillWant([]*float64{utils.Ptr(float64(1)), utils.Ptr(float64(0)), utils.Ptr(float64(3)), utils.Ptr(float64(0))}),
+	}
+	f(o)
+
+	o = opts{
+		filename: "test-data/stats_range_response_sparse",
+		q:        fillQuery(fillPrevious),
+		want:     fillWant([]*float64{utils.Ptr(float64(1)), utils.Ptr(float64(1)), utils.Ptr(float64(3)), utils.Ptr(float64(3))}),
+	}
+	f(o)
+
+	// non-numeric stats values are returned as a table frame, numeric ones as usual
+	o = opts{
+		filename: "test-data/stats_non_numeric_response",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			LegendFormat: "legend {{app}}",
+		},
+		want: func() backend.DataResponse {
+			ts := time.Unix(1730937600, 0)
+			numeric := data.NewFrame("legend web",
+				data.NewField(data.TimeSeriesTimeFieldName, nil, []time.Time{ts}),
+				data.NewField("count(*)", data.Labels{"__name__": "count(*)", "app": "web"}, []*float64{utils.Ptr(float64(5))}).SetConfig(&data.FieldConfig{DisplayNameFromDS: "legend web"}),
+			)
+			table := data.NewFrame("",
+				data.NewField(gTimeField, nil, []time.Time{ts, ts}),
+				data.NewField("__name__", nil, []string{"uniq_values(host)", "row_any(*)"}),
+				data.NewField("app", nil, []string{"api", ""}),
+				data.NewField(gValueField, nil, []string{`["a","b"]`, `{"_msg":"hello"}`}),
+			).SetMeta(&data.FrameMeta{Type: data.FrameTypeTable, PreferredVisualization: data.VisTypeTable})
+			return backend.DataResponse{Frames: data.Frames{numeric, table}}
+		},
+	}
+	f(o)
+
+	// non-numeric stats values can't be used for alerting
+	o = opts{
+		filename: "test-data/stats_non_numeric_response",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			ForAlerting: true,
+		},
+		want: func() backend.DataResponse {
+			return newResponseError(fmt.Errorf("failed to prepare data from response: alerting queries require numeric stats results, got non-numeric values for row_any(*), uniq_values(host)"), backend.StatusInternal)
+		},
+	}
+	f(o)
+
+	// instant stats in the numeric wide format
+	o = opts{
+		filename: "test-data/stats_by_labels_response",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			Format: formatTable,
+		},
+		want: func() backend.DataResponse {
+			frame := data.NewFrame("",
+				data.NewField("count(*)", data.Labels{"service": "api", "status": "200"}, []*float64{utils.Ptr(float64(10))}),
+				data.NewField("count(*)", data.Labels{"service": "api", "status": "500"}, []*float64{utils.Ptr(float64(2))}),
+				data.NewField("avg(duration)", data.Labels{"service": "api", "status": "200"}, []*float64{utils.Ptr(0.5)}),
+				data.NewField("count(*)", data.Labels{"service": "web", "status": "200"}, []*float64{utils.Ptr(float64(7))}),
+			).SetMeta(&data.FrameMeta{
+				Type:                   data.FrameTypeNumericWide,
+				TypeVersion:            data.FrameTypeVersion{0, 1},
+				PreferredVisualization: data.VisTypeTable,
+			})
+			return backend.DataResponse{Frames: data.Frames{frame}}
+		},
+	}
+	f(o)
+
+	// histogram series are converted into heatmap cells with sorted buckets,
+	// the series with the invalid vmrange label is skipped with a notice
+	histogramWant := func(counts []float64) func() backend.DataResponse {
+		return func() backend.DataResponse {
+			ts1, ts2 := time.Unix(1704067200, 0), time.Unix(1704067260, 0)
+			xMax := data.NewField(gXMaxField, nil, []time.Time{ts1, ts1, ts2, ts2})
+			xMax.Config = &data.FieldConfig{Interval: 60000}
+			frame := data.NewFrame(`{host="a"}`,
+				xMax,
+				data.NewField(gYMinField, nil, []float64{0, 1, 0, 1}),
+				data.NewField(gYMaxField, nil, []float64{1, 2, 1, 2}),
+				data.NewField(gCountField, data.Labels{"host": "a"}, counts),
+			).SetMeta(&data.FrameMeta{Type: frameTypeHeatmapCells})
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: histogramSkippedNotice(1)})
+			return backend.DataResponse{Frames: data.Frames{frame}}
+		}
+	}
+	o = opts{
+		filename: "test-data/stats_range_histogram_response",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			Format: formatHistogram,
+		},
+		want: histogramWant([]float64{5, 2, 0, 3}),
+	}
+	f(o)
+
+	// cumulative histogram counts
+	o = opts{
+		filename: "test-data/stats_range_histogram_response",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			Format:              formatHistogram,
+			HistogramCumulative: true,
+		},
+		want: histogramWant([]float64{5, 7, 0, 3}),
+	}
+	f(o)
+
+	// series without vmrange label are reported instead of returning nothing silently
+	o = opts{
+		filename: "test-data/stats_range_response",
+		q: &Query{
+			DataQuery: backend.DataQuery{
+				RefID: "A",
+			},
+			Format: formatHistogram,
+		},
+		want: func() backend.DataResponse {
+			frame := data.NewFrame("").SetMeta(&data.FrameMeta{Type: frameTypeHeatmapCells})
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: histogramSkippedNotice(1)})
+			return backend.DataResponse{Frames: data.Frames{frame}}
+		},
+	}
+	f(o)
+}
+
+func histogramSkippedNotice(n int) string {
+	return fmt.Sprintf("%d series without a valid vmrange label were skipped, the histogram format expects series of the `histogram` stats function", n)
 }
@@ -0,0 +1,251 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
+)
+
+const (
+	// defaultLiveWindow is the default sliding window of the live stats query
+	defaultLiveWindow = 15 * time.Minute
+	// minLiveInterval and maxLiveInterval limit how often the live stats query is executed,
+	// the query is executed once per step within these limits
+	minLiveInterval = time.Second
+	maxLiveInterval = time.Minute
+
+	// gLiveLabelsField is the field with series labels of the live stats frame.
+	// Grafana splits streaming frames with the first string field named `labels` into separate series.
+	gLiveLabelsField = "labels"
+)
+
+// isLiveStats checks whether the live mode of the query streams stats instead of tailing logs
+func (q *Query) isLiveStats() bool {
+	return q.QueryType == QueryTypeStatsRange || q.QueryType == QueryTypeHits
+}
+
+// liveWindow returns the sliding window of the live stats query
+func (q *Query) liveWindow() (time.Duration, error) {
+	if q.LiveWindow == "" {
+		return defaultLiveWindow, nil
+	}
+	d, err := utils.ParseDuration(q.LiveWindow)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse live window %q: %w", q.LiveWindow, err)
+	}
+	if d <= 0 {
+		return defaultLiveWindow, nil
+	}
+	return d, nil
+}
+
+// liveInterval returns how often the live stats query is executed
+func liveInterval(step time.Duration) time.Duration {
+	if step < minLiveInterval {
+		return minLiveInterval
+	}
+	if step > maxLiveInterval {
+		return maxLiveInterval
+	}
+	return step
+}
+
+// streamStatsQuery executes the stats range or hits query over the sliding window
+// on every step and sends new and updated buckets to the livestream channel
+// until the context is canceled.
+// Buckets are marked as sent only after the frame is handed to the livestream channel,
+// which isn't passed through the tail queue, so updates are never dropped.
+func (di *DatasourceInstance) streamStatsQuery(ctx context.Context, request *backend.RunStreamRequest, livestream chan *data.Frame) error {
+	q, err := getQueryFromRaw(request.Data, false)
+	if err != nil {
+		return err
+	}
+	window, err := q.liveWindow()
+	if err != nil {
+		return err
+	}
+
+	buckets := newLiveBuckets()
+	for n := 0; ; n++ {
+		sq, err := getQueryFromRaw(request.Data, false)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		sq.TimeRange = backend.TimeRange{From: now.Add(-window), To: now}
+
+		resp := di.query(ctx, sq)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if resp.Error != nil {
+			if n == 0 {
+				// the query never succeeded, most likely it is wrong
+				return resp.Error
+			}
+			backend.Logger.Warn("failed to execute live stats query", "path", request.Path, "error", resp.Error)
+		} else if frame := buckets.changes(resp.Frames, sq.TimeRange.From); frame != nil {
+			select {
+			case livestream <- frame:
+				buckets.markSent(frame)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		t := time.NewTimer(liveInterval(sq.step))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// liveBuckets contains the last sent values of the live stats series by labels and bucket time
+type liveBuckets struct {
+	series map[string]map[time.Time]*float64
+}
+
+func newLiveBuckets() *liveBuckets {
+	return &liveBuckets{series: make(map[string]map[time.Time]*float64)}
+}
+
+// changes returns the frame with buckets of the frames
+// which are new or have changed since they were marked as sent.
+// Buckets before minTime are forgotten. It returns nil if nothing has changed.
+func (lb *liveBuckets) changes(frames data.Frames, minTime time.Time) *data.Frame {
+	live := newLiveStatsFrame()
+	labelsFd, timeFd, valueFd := live.Fields[0], live.Fields[1], live.Fields[2]
+
+	for _, frame := range frames {
+		tsFd, valFd := liveSeriesFields(frame)
+		if tsFd == nil || valFd == nil {
+			// e.g. hits totals or notice frames
+			continue
+		}
+		key := liveLabelsString(valFd)
+		buckets := lb.series[key]
+		for i := 0; i < tsFd.Len(); i++ {
+			ts, ok := tsFd.At(i).(time.Time)
+			if !ok || ts.Before(minTime) {
+				continue
+			}
+			v, _ := valFd.NullableFloatAt(i)
+			if prev, ok := buckets[ts]; ok && equalNullableFloat(prev, v) {
+				continue
+			}
+			labelsFd.Append(key)
+			timeFd.Append(ts)
+			valueFd.Append(v)
+		}
+	}
+
+	for key, buckets := range lb.series {
+		for ts := range buckets {
+			if ts.Before(minTime) {
+				delete(buckets, ts)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(lb.series, key)
+		}
+	}
+
+	if labelsFd.Len() == 0 {
+		return nil
+	}
+	return live
+}
+
+// markSent remembers the buckets of the frame returned by changes
+func (lb *liveBuckets) markSent(frame *data.Frame) {
+	labelsFd, timeFd, valueFd := frame.Fields[0], frame.Fields[1], frame.Fields[2]
+	for i := 0; i < frame.Rows(); i++ {
+		key := labelsFd.At(i).(string)
+		buckets, ok := lb.series[key]
+		if !ok {
+			buckets = make(map[time.Time]*float64)
+			lb.series[key] = buckets
+		}
+		v, _ := valueFd.NullableFloatAt(i)
+		buckets[timeFd.At(i).(time.Time)] = v
+	}
+}
+
+// newLiveStatsFrame returns an empty frame with the fields of the live stats stream
+func newLiveStatsFrame() *data.Frame {
+	labelsFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+	labelsFd.Name = gLiveLabelsField
+	timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, 0)
+	timeFd.Name = gTimeField
+	valueFd := data.NewFieldFromFieldType(data.FieldTypeNullableFloat64, 0)
+	valueFd.Name = gValueField
+	return data.NewFrame("", labelsFd, timeFd, valueFd)
+}
+
+// newLiveStatsNoticeFrame returns an empty live stats frame with the notice about the stream state.
+// It has the same fields as the frames with buckets, so it doesn't reset the live series.
+func newLiveStatsNoticeFrame(format string, args ...any) *data.Frame {
+	frame := newLiveStatsFrame()
+	frame.Meta = &data.FrameMeta{
+		Notices: []data.Notice{{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf(format, args...),
+		}},
+	}
+	return frame
+}
+
+// liveSeriesFields returns the time and the value fields of the series frame
+func liveSeriesFields(frame *data.Frame) (*data.Field, *data.Field) {
+	var tsFd, valFd *data.Field
+	for _, fd := range frame.Fields {
+		switch {
+		case fd.Type() == data.FieldTypeTime && tsFd == nil:
+			tsFd = fd
+		case fd.Type().Numeric() && valFd == nil:
+			valFd = fd
+		}
+	}
+	return tsFd, valFd
+}
+
+// liveLabelsString returns labels of the value field in the `{name="value"}` format
+// parsed by Grafana for the labels field of the streaming frame
+func liveLabelsString(fd *data.Field) string {
+	labels := fd.Labels
+	if _, ok := labels[metricsName]; !ok && fd.Name != gValueField {
+		labels = labels.Copy()
+		if labels == nil {
+			labels = make(data.Labels)
+		}
+		labels[metricsName] = fd.Name
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func equalNullableFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
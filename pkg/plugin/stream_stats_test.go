@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
+)
+
+func TestLiveBuckets_update(t *testing.T) {
+	type bucket struct {
+		labels string
+		ts     int64
+		value  *float64
+	}
+	ts := func(sec int64) time.Time {
+		return time.Unix(sec, 0).UTC()
+	}
+	series := func(labels data.Labels, values map[int64]*float64) *data.Frame {
+		var times []time.Time
+		var vals []*float64
+		for _, sec := range []int64{60, 120, 180} {
+			if v, ok := values[sec]; ok {
+				times = append(times, ts(sec))
+				vals = append(vals, v)
+			}
+		}
+		return data.NewFrame("",
+			data.NewField(gTimeField, nil, times),
+			data.NewField("count(*)", labels, vals),
+		)
+	}
+
+	lb := newLiveBuckets()
+	f := func(frames data.Frames, minTime int64, sent bool, want []bucket) {
+		t.Helper()
+		frame := lb.changes(frames, ts(minTime))
+		var got []bucket
+		if frame != nil {
+			if sent {
+				lb.markSent(frame)
+			}
+			for i := 0; i < frame.Rows(); i++ {
+				v, _ := frame.Fields[2].NullableFloatAt(i)
+				got = append(got, bucket{
+					labels: frame.Fields[0].At(i).(string),
+					ts:     frame.Fields[1].At(i).(time.Time).Unix(),
+					value:  v,
+				})
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected buckets\n got: %v\nwant: %v", got, want)
+		}
+	}
+
+	api := data.Labels{"__name__": "count(*)", "app": "api"}
+	web := data.Labels{"__name__": "count(*)", "app": "web"}
+	apiKey := `{__name__="count(*)", app="api"}`
+	webKey := `{__name__="count(*)", app="web"}`
+
+	// all buckets are sent initially
+	f(data.Frames{
+		series(api, map[int64]*float64{60: utils.Ptr(1.0), 120: utils.Ptr(2.0)}),
+	}, 0, true, []bucket{
+		{labels: apiKey, ts: 60, value: utils.Ptr(1.0)},
+		{labels: apiKey, ts: 120, value: utils.Ptr(2.0)},
+	})
+
+	// buckets which weren't sent are returned again
+	f(data.Frames{
+		series(api, map[int64]*float64{60: utils.Ptr(1.0), 120: utils.Ptr(3.0)}),
+	}, 0, false, []bucket{
+		{labels: apiKey, ts: 120, value: utils.Ptr(3.0)},
+	})
+
+	// only updated and new buckets of the known and new series are sent
+	f(data.Frames{
+		series(api, map[int64]*float64{60: utils.Ptr(1.0), 120: utils.Ptr(3.0), 180: utils.Ptr(1.0)}),
+		series(web, map[int64]*float64{180: nil}),
+	}, 0, true, []bucket{
+		{labels: apiKey, ts: 120, value: utils.Ptr(3.0)},
+		{labels: apiKey, ts: 180, value: utils.Ptr(1.0)},
+		{labels: webKey, ts: 180, value: nil},
+	})
+
+	// nothing has changed
+	f(data.Frames{
+		series(api, map[int64]*float64{120: utils.Ptr(3.0), 180: utils.Ptr(1.0)}),
+	}, 120, true, nil)
+
+	// buckets out of the window are forgotten
+	f(data.Frames{
+		series(api, map[int64]*float64{60: utils.Ptr(1.0), 180: utils.Ptr(1.0)}),
+	}, 60, true, []bucket{
+		{labels: apiKey, ts: 60, value: utils.Ptr(1.0)},
+	})
+}
+
+func TestDatasourceStreamStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/tail", func(_ http.ResponseWriter, _ *http.Request) {
+		t.Errorf("tail should not be called")
+	})
+	mux.HandleFunc("/select/logsql/stats_query_range", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		start, _ := strconv.ParseInt(r.Form.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.Form.Get("end"), 10, 64)
+		if end-start != 3600 {
+			t.Errorf("expected the query over the live window, got start=%d end=%d", start, end)
+		}
+		ts := end - end%60
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"count(*)","app":"api"},"values":[[%d,"2"],[%d,"3"]]}]}}`, ts-60, ts)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDatasource()
+	packetSender := &mockStreamSender{packets: []json.RawMessage{}}
+	sender := backend.NewStreamSender(packetSender)
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			URL:      srv.URL,
+			JSONData: []byte(`{"httpMethod":"POST"}`),
+		},
+	}
+	_, _ = d.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
+		PluginContext: pluginCtx,
+		Path:          "request_id/ref_id",
+		Data:          json.RawMessage(`{"expr":"* | stats by (app) count()","refId":"A","queryType":"statsRange","step":"1m","liveWindow":"1h"}`),
+	})
+
+	runStreamDone := make(chan error, 1)
+	go func() {
+		runStreamDone <- d.RunStream(ctx, &backend.RunStreamRequest{
+			PluginContext: pluginCtx,
+			Path:          "request_id/ref_id",
+			Data:          json.RawMessage(`{"expr":"* | stats by (app) count()","refId":"A","queryType":"statsRange","step":"1m","liveWindow":"1h"}`),
+		}, sender)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for len(packetSender.GetStream()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected live stats frame")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// the datasource settings have changed
+	di, err := d.getInstance(ctx, pluginCtx)
+	if err != nil {
+		t.Fatalf("unexpected instance error: %s", err)
+	}
+	di.Dispose()
+	if err := <-runStreamDone; err != nil {
+		t.Fatalf("unexpected stream error: %s", err)
+	}
+
+	var frame data.Frame
+	if err := frame.UnmarshalJSON(packetSender.GetStream()[0]); err != nil {
+		t.Fatalf("cannot unmarshal frame: %s", err)
+	}
+	if frame.Rows() != 2 || frame.Fields[0].Name != gLiveLabelsField {
+		t.Fatalf("unexpected live stats frame %v", frame)
+	}
+	if got := frame.Fields[0].At(0).(string); got != `{__name__="count(*)", app="api"}` {
+		t.Fatalf("unexpected series labels %q", got)
+	}
+
+	// the notice has the fields of the live stats frame, so it doesn't reset the series
+	stream := packetSender.GetStream()
+	var notice data.Frame
+	if err := notice.UnmarshalJSON(stream[len(stream)-1]); err != nil {
+		t.Fatalf("cannot unmarshal frame: %s", err)
+	}
+	if notice.Rows() != 0 || len(notice.Fields) != 3 || notice.Fields[0].Name != gLiveLabelsField {
+		t.Fatalf("unexpected notice frame fields %v", notice)
+	}
+	if notice.Meta == nil || len(notice.Meta.Notices) != 1 || !strings.Contains(notice.Meta.Notices[0].Text, "datasource settings changed") {
+		t.Fatalf("unexpected notice frame %v", notice.Meta)
+	}
+}
@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// tailBackfillWindow limits the time window of the backfill query with the number of log lines
+	tailBackfillWindow = time.Hour
+	// tailResumeOverlap is the time window before the last delivered row
+	// which is requested again after reconnect, rows from this window are deduplicated
+	tailResumeOverlap = 5 * time.Second
+)
+
+var (
+	// tailReconnectMinBackoff is the delay before the first reconnect attempt
+	tailReconnectMinBackoff = 500 * time.Millisecond
+	// tailReconnectMaxBackoff is the max delay between reconnect attempts
+	tailReconnectMaxBackoff = 30 * time.Second
+)
+
+// tailCursor tracks rows delivered by the live tail,
+// so the tail can be resumed after reconnect without duplicates
+type tailCursor struct {
+	lastTime time.Time
+	// seen contains rows delivered within tailResumeOverlap before lastTime.
+	// Identical log entries have the same id, so the number of delivered rows is counted.
+	seen map[string]*tailSeenRow
+	// received counts rows with the same id received by the current connection
+	received map[string]int
+}
+
+type tailSeenRow struct {
+	time      time.Time
+	delivered int
+}
+
+func newTailCursor() *tailCursor {
+	return &tailCursor{
+		seen:     make(map[string]*tailSeenRow),
+		received: make(map[string]int),
+	}
+}
+
+// resume must be called before reading rows of the new connection
+func (c *tailCursor) resume() {
+	c.received = make(map[string]int)
+}
+
+// add registers the row and returns false if it was already delivered
+func (c *tailCursor) add(row logRow) bool {
+	c.received[row.ID]++
+	sr, ok := c.seen[row.ID]
+	if !ok {
+		sr = &tailSeenRow{time: row.Time}
+		c.seen[row.ID] = sr
+	}
+	if c.received[row.ID] <= sr.delivered {
+		return false
+	}
+	sr.delivered++
+	if row.Time.After(c.lastTime) {
+		c.lastTime = row.Time
+	}
+	return true
+}
+
+// prune forgets rows which can't be requested again after reconnect
+func (c *tailCursor) prune() {
+	minTime := c.lastTime.Add(-tailResumeOverlap)
+	for id, sr := range c.seen {
+		if sr.time.Before(minTime) {
+			delete(c.seen, id)
+			delete(c.received, id)
+		}
+	}
+}
+
+// skipDelivered returns the frame without rows already delivered according to the cursor.
+// It returns nil if all the frame rows were delivered.
+func (c *tailCursor) skipDelivered(frame *data.Frame) *data.Frame {
+	timeFd, _ := frame.FieldByName(gTimeField)
+	idFd, _ := frame.FieldByName(gIDField)
+	if timeFd == nil || idFd == nil || frame.Rows() == 0 {
+		return frame
+	}
+
+	keep := make([]bool, frame.Rows())
+	var kept int
+	for i := range keep {
+		ts, _ := timeFd.ConcreteAt(i)
+		id, _ := idFd.ConcreteAt(i)
+		t, _ := ts.(time.Time)
+		idStr, _ := id.(string)
+		if c.add(logRow{Time: t, ID: idStr}) {
+			keep[i] = true
+			kept++
+		}
+	}
+	c.prune()
+
+	switch kept {
+	case len(keep):
+		return frame
+	case 0:
+		return nil
+	default:
+		return filterFrameRows(frame, func(i int) bool { return keep[i] })
+	}
+}
+
+// startOffset returns how far back the resumed tail must look
+// to return rows since the last delivered one, it is 0 if nothing was delivered yet
+func (c *tailCursor) startOffset(now time.Time) time.Duration {
+	if c.lastTime.IsZero() {
+		return 0
+	}
+	offset := now.Sub(c.lastTime) + tailResumeOverlap
+	if offset < tailResumeOverlap {
+		offset = tailResumeOverlap
+	}
+	return offset.Truncate(time.Second) + time.Second
+}
+
+// parseTailBackfillResponse sends rows of the backfill query to the channel
+// in the time order, so they look like the tailed rows. Sent rows are registered in the cursor.
+func parseTailBackfillResponse(reader io.Reader, ch chan *data.Frame, batch tailBatch, cursor *tailCursor) error {
+	var rows []logRow
+	if err := readLogRows(reader, func(row logRow) {
+		rows = append(rows, row)
+	}); err != nil {
+		return err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Time.Before(rows[j].Time)
+	})
+
+	frame := newLogFrame()
+	for _, row := range rows {
+		cursor.add(row)
+		frame.append(row)
+		if len(frame.streamIds) >= batch.maxRows {
+			ch <- frame.streamFrame()
+			frame = newLogFrame()
+		}
+	}
+	if len(frame.streamIds) > 0 {
+		ch <- frame.streamFrame()
+	}
+	return nil
+}
+
+// nextTailBackoff doubles the reconnect delay up to tailReconnectMaxBackoff
+func nextTailBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > tailReconnectMaxBackoff {
+		backoff = tailReconnectMaxBackoff
+	}
+	return backoff
+}
+
+// tailReader remembers read errors of the tail connection,
+// so they can be distinguished from errors in the response data
+type tailReader struct {
+	r   io.Reader
+	err error
+}
+
+func (tr *tailReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		tr.err = err
+	}
+	return n, err
+}
+
+// newTailNoticeFrame returns an empty logs frame with the notice about the live tail state.
+// It has the same fields as the frames with rows, so it doesn't reset the live logs view.
+func newTailNoticeFrame(format string, args ...any) *data.Frame {
+	frame := newLogFrame().dataFrame
+	frame.Meta = &data.FrameMeta{
+		PreferredVisualization: logsVisualisation,
+		Notices: []data.Notice{{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf(format, args...),
+		}},
+	}
+	return frame
+}
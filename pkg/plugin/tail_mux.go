@@ -0,0 +1,190 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// tailMux shares a single upstream tail connection between all the live streams
+// of the datasource instance with the same tail request.
+type tailMux struct {
+	// ctx is the parent context of the upstream tails, it is canceled when the instance is disposed
+	ctx context.Context
+
+	mu    sync.Mutex
+	tails map[string]*sharedTail
+}
+
+func newTailMux(ctx context.Context) *tailMux {
+	return &tailMux{
+		ctx:   ctx,
+		tails: make(map[string]*sharedTail),
+	}
+}
+
+// sharedTail is the upstream tail connection with its subscribers
+type sharedTail struct {
+	cancel context.CancelFunc
+	subs   map[*tailSubscriber]struct{}
+	// done is closed when the upstream tail stops, err contains the reason
+	done chan struct{}
+	err  error
+}
+
+// tailSubscriber is the live stream which receives frames of the shared tail.
+// Every subscriber has its own queue, so a slow client doesn't stall the shared tail for other subscribers.
+type tailSubscriber struct {
+	ch    chan *data.Frame
+	queue *tailQueue
+	left  chan struct{}
+	// done is closed when the frames are no longer sent to ch
+	done chan struct{}
+}
+
+func newTailSubscriber(key string, ch chan *data.Frame, buf tailBuffer) *tailSubscriber {
+	if buf.policy == tailPolicyBlock {
+		// the shared tail can't wait for a single slow subscriber
+		backend.Logger.Debug("the block policy is replaced with dropOldest for the shared tail", "key", key)
+		buf.policy = tailPolicyDropOldest
+	}
+	return &tailSubscriber{
+		ch:    ch,
+		queue: newTailQueue(key, buf),
+		left:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// send adds the frame to the subscriber queue, it never blocks
+func (sub *tailSubscriber) send(frame *data.Frame) {
+	sub.queue.push(frame)
+}
+
+// forward sends queued frames to the live stream until the subscriber leaves.
+// Rows already delivered according to the cursor, e.g. by the backfill, are skipped.
+func (sub *tailSubscriber) forward(cursor *tailCursor) {
+	defer close(sub.done)
+	for {
+		frame, ok := sub.queue.pop()
+		if !ok {
+			return
+		}
+		frame = cursor.skipDelivered(frame)
+		if frame == nil {
+			continue
+		}
+		select {
+		case sub.ch <- frame:
+		case <-sub.left:
+			return
+		}
+	}
+}
+
+// run subscribes the livestream to the tail with the given key until the context is canceled
+// or the tail stops. The tail is started with the start func if there is no tail with the key yet.
+// The backfill func is called after the livestream joined the tail, it registers sent rows in the cursor,
+// so rows between the backfill and the tail are neither lost nor duplicated.
+// It returns the error of the tail which stopped.
+func (tm *tailMux) run(ctx context.Context, key string, livestream chan *data.Frame, buf tailBuffer,
+	backfill func(ctx context.Context, cursor *tailCursor), start func(ctx context.Context, out chan *data.Frame) error) error {
+	sub := newTailSubscriber(key, livestream, buf)
+	st := tm.subscribe(key, sub, start)
+	defer tm.unsubscribe(key, st, sub)
+
+	cursor := newTailCursor()
+	backfill(ctx, cursor)
+	cursor.resume()
+	go sub.forward(cursor)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-st.done:
+		return st.err
+	}
+}
+
+func (tm *tailMux) subscribe(key string, sub *tailSubscriber, start func(ctx context.Context, out chan *data.Frame) error) *sharedTail {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	st, ok := tm.tails[key]
+	if !ok {
+		// the upstream tail outlives the live stream which started it
+		ctx, cancel := context.WithCancel(tm.ctx)
+		st = &sharedTail{
+			cancel: cancel,
+			subs:   make(map[*tailSubscriber]struct{}),
+			done:   make(chan struct{}),
+		}
+		tm.tails[key] = st
+		go tm.serve(ctx, key, st, start)
+	} else {
+		backend.Logger.Debug("live stream joined the shared tail", "key", key, "subscribers", len(st.subs)+1)
+	}
+	st.subs[sub] = struct{}{}
+	return st
+}
+
+// unsubscribe removes the subscriber and closes the upstream tail after the last subscriber left
+func (tm *tailMux) unsubscribe(key string, st *sharedTail, sub *tailSubscriber) {
+	close(sub.left)
+	sub.queue.close()
+	// wait for the frame being sent, so nothing is written to the livestream after return
+	<-sub.done
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	delete(st.subs, sub)
+	if len(st.subs) > 0 {
+		return
+	}
+	if tm.tails[key] == st {
+		delete(tm.tails, key)
+	}
+	st.cancel()
+}
+
+// serve runs the upstream tail and fans its frames out to all the subscribers
+func (tm *tailMux) serve(ctx context.Context, key string, st *sharedTail, start func(ctx context.Context, out chan *data.Frame) error) {
+	out := make(chan *data.Frame)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- start(ctx, out)
+		close(out)
+	}()
+
+	for frame := range out {
+		tm.mu.Lock()
+		subs := make([]*tailSubscriber, 0, len(st.subs))
+		for sub := range st.subs {
+			subs = append(subs, sub)
+		}
+		tm.mu.Unlock()
+
+		for _, sub := range subs {
+			sub.send(copyTailFrame(frame))
+		}
+	}
+
+	tm.mu.Lock()
+	st.err = <-errCh
+	if tm.tails[key] == st {
+		delete(tm.tails, key)
+	}
+	tm.mu.Unlock()
+	st.cancel()
+	close(st.done)
+}
+
+// copyTailFrame returns the frame copy which can be changed by the subscriber,
+// e.g. by adding derived fields. Fields and meta are shared, since they are never modified.
+func copyTailFrame(frame *data.Frame) *data.Frame {
+	cp := *frame
+	cp.Fields = append([]*data.Field(nil), frame.Fields...)
+	return &cp
+}
@@ -0,0 +1,220 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var testTailBuffer = tailBuffer{size: 10, policy: tailPolicyBlock}
+
+func noTailBackfill(_ context.Context, _ *tailCursor) {}
+
+func TestTailMux(t *testing.T) {
+	tm := newTailMux(context.Background())
+	var starts atomic.Int32
+	frames := make(chan *data.Frame)
+	stopped := make(chan struct{})
+	start := func(ctx context.Context, out chan *data.Frame) error {
+		starts.Add(1)
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case frame := <-frames:
+				out <- frame
+			}
+		}
+	}
+
+	subscribers := func() int {
+		tm.mu.Lock()
+		defer tm.mu.Unlock()
+		if st, ok := tm.tails["key"]; ok {
+			return len(st.subs)
+		}
+		return 0
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel1()
+	defer cancel2()
+	ch1 := make(chan *data.Frame, 1)
+	ch2 := make(chan *data.Frame, 1)
+	done1 := make(chan error, 1)
+	done2 := make(chan error, 1)
+	go func() { done1 <- tm.run(ctx1, "key", ch1, testTailBuffer, noTailBackfill, start) }()
+	go func() { done2 <- tm.run(ctx2, "key", ch2, testTailBuffer, noTailBackfill, start) }()
+
+	deadline := time.After(time.Second)
+	for subscribers() != 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected 2 subscribers of the shared tail, got %d", subscribers())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	frames <- data.NewFrame("frame")
+	got1, got2 := <-ch1, <-ch2
+	if got1.Name != "frame" || got2.Name != "frame" {
+		t.Fatalf("unexpected frames %q and %q", got1.Name, got2.Name)
+	}
+	if got1 == got2 {
+		t.Fatalf("expected every subscriber to get its own frame copy")
+	}
+
+	// the upstream tail keeps running while there are subscribers
+	cancel1()
+	if err := <-done1; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	select {
+	case <-stopped:
+		t.Fatalf("expected the upstream tail to keep running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the upstream tail is closed after the last subscriber left
+	cancel2()
+	if err := <-done2; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the upstream tail to be closed")
+	}
+	if n := starts.Load(); n != 1 {
+		t.Fatalf("expected a single upstream tail, got %d", n)
+	}
+	if subscribers() != 0 {
+		t.Fatalf("expected the shared tail to be removed")
+	}
+}
+
+func TestTailMuxError(t *testing.T) {
+	tm := newTailMux(context.Background())
+	wantErr := errors.New("cannot connect")
+	err := tm.run(context.Background(), "key", make(chan *data.Frame, 1), testTailBuffer, noTailBackfill, func(_ context.Context, _ chan *data.Frame) error {
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if len(tm.tails) != 0 {
+		t.Fatalf("expected the failed tail to be removed")
+	}
+}
+
+func TestTailMuxSlowSubscriber(t *testing.T) {
+	tm := newTailMux(context.Background())
+	frames := make(chan *data.Frame)
+	start := func(ctx context.Context, out chan *data.Frame) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case frame := <-frames:
+				out <- frame
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the slow subscriber never reads its live stream
+	slow := make(chan *data.Frame)
+	fast := make(chan *data.Frame, 1)
+	joined := make(chan struct{}, 2)
+	joinBackfill := func(_ context.Context, _ *tailCursor) { joined <- struct{}{} }
+	go func() { _ = tm.run(ctx, "key", slow, testTailBuffer, joinBackfill, start) }()
+	go func() { _ = tm.run(ctx, "key", fast, testTailBuffer, joinBackfill, start) }()
+	<-joined
+	<-joined
+
+	for i := 0; i < 3*testTailBuffer.size; i++ {
+		select {
+		case frames <- data.NewFrame("frame"):
+		case <-time.After(time.Second):
+			t.Fatalf("the shared tail is blocked by the slow subscriber after %d frames", i)
+		}
+		select {
+		case <-fast:
+		case <-time.After(time.Second):
+			t.Fatalf("the fast subscriber didn't get frame %d", i)
+		}
+	}
+}
+
+func TestTailMuxBackfill(t *testing.T) {
+	tm := newTailMux(context.Background())
+	ts := time.Unix(1704067200, 0).UTC()
+	row := func(sec int, msg string) logRow {
+		t := ts.Add(time.Duration(sec) * time.Second)
+		return logRow{Time: t, Line: msg, ID: msg, Labels: []byte("{}")}
+	}
+	frameOf := func(rows ...logRow) *data.Frame {
+		frame := newLogFrame()
+		for _, r := range rows {
+			frame.append(r)
+		}
+		return frame.streamFrame()
+	}
+
+	tailed := make(chan struct{})
+	start := func(ctx context.Context, out chan *data.Frame) error {
+		<-tailed
+		// the tail overlaps with the backfill
+		out <- frameOf(row(1, "b"), row(2, "c"))
+		out <- frameOf(row(3, "d"))
+		<-ctx.Done()
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	livestream := make(chan *data.Frame, 10)
+	backfill := func(_ context.Context, cursor *tailCursor) {
+		// rows tailed while the backfill is running are queued, not lost
+		close(tailed)
+		time.Sleep(10 * time.Millisecond)
+		for _, r := range []logRow{row(0, "a"), row(1, "b")} {
+			cursor.add(r)
+		}
+		livestream <- frameOf(row(0, "a"), row(1, "b"))
+	}
+	done := make(chan error, 1)
+	go func() { done <- tm.run(ctx, "key", livestream, testTailBuffer, backfill, start) }()
+
+	var lines []string
+	deadline := time.After(time.Second)
+	for len(lines) < 4 {
+		select {
+		case frame := <-livestream:
+			fd, _ := frame.FieldByName(gLineField)
+			for i := 0; i < fd.Len(); i++ {
+				lines = append(lines, fd.At(i).(string))
+			}
+		case <-deadline:
+			t.Fatalf("expected 4 lines, got %q", lines)
+		}
+	}
+	if got := strings.Join(lines, ","); got != "a,b,c,d" {
+		t.Fatalf("unexpected lines %q; want %q", got, "a,b,c,d")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// tailPolicyBlock makes the live stream wait for the slow client, so VictoriaLogs buffers the tailed logs
+	tailPolicyBlock = "block"
+	// tailPolicyDropOldest drops the oldest buffered frames when the buffer is full
+	tailPolicyDropOldest = "dropOldest"
+	// tailPolicySample keeps every tailSampleRate-th line when the buffer is half full
+	// and drops new frames when the buffer is full
+	tailPolicySample = "sample"
+
+	// defaultTailBufferSize is the default number of frames buffered for the slow client
+	defaultTailBufferSize = 100
+	// tailSampleRate is the rate of lines kept by the sample policy
+	tailSampleRate = 10
+	// tailDropNoticeInterval is the min interval between notices about dropped lines
+	tailDropNoticeInterval = 5 * time.Second
+)
+
+// tailDroppedLines counts the lines dropped because the client can't keep up with the live stream.
+// It is exposed by the plugin metrics endpoint of Grafana.
+var tailDroppedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "victorialogs_datasource",
+	Name:      "tail_dropped_lines_total",
+	Help:      "The total number of live tail lines dropped because the client can't keep up with the live stream",
+}, []string{"policy"})
+
+// tailBuffer configures the buffer between the live stream and the client
+type tailBuffer struct {
+	size   int
+	policy string
+}
+
+// parseTailDropPolicy checks the drop policy and returns the default one if it is empty
+func parseTailDropPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return tailPolicyBlock, nil
+	case tailPolicyBlock, tailPolicyDropOldest, tailPolicySample:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported tail drop policy %q; supported policies: %s, %s, %s",
+			policy, tailPolicyBlock, tailPolicyDropOldest, tailPolicySample)
+	}
+}
+
+// tailQueue is the bounded queue of frames sent to the client.
+// The queue drops or samples frames according to the policy, when the client can't keep up with the stream.
+type tailQueue struct {
+	path string
+	buf  tailBuffer
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	frames []*data.Frame
+	closed bool
+
+	// dropped is the number of lines dropped since the last notice
+	dropped      int
+	droppedTotal int
+	lastNotice   time.Time
+}
+
+func newTailQueue(path string, buf tailBuffer) *tailQueue {
+	tq := &tailQueue{
+		path: path,
+		buf:  buf,
+	}
+	tq.cond = sync.NewCond(&tq.mu)
+	return tq
+}
+
+// push adds the frame to the queue according to the policy.
+// It waits for the free space with the block policy.
+func (tq *tailQueue) push(frame *data.Frame) {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	switch tq.buf.policy {
+	case tailPolicyDropOldest:
+		for len(tq.frames) >= tq.buf.size {
+			tq.drop(tq.frames[0].Rows())
+			tq.frames[0] = nil
+			tq.frames = tq.frames[1:]
+		}
+	case tailPolicySample:
+		switch {
+		case len(tq.frames) >= tq.buf.size:
+			tq.drop(frame.Rows())
+			return
+		case len(tq.frames) >= tq.buf.size/2:
+			sampled := sampleFrame(frame, tailSampleRate)
+			tq.drop(frame.Rows() - sampled.Rows())
+			frame = sampled
+		}
+	default:
+		for len(tq.frames) >= tq.buf.size && !tq.closed {
+			tq.cond.Wait()
+		}
+	}
+
+	tq.frames = append(tq.frames, frame)
+	tq.cond.Broadcast()
+}
+
+func (tq *tailQueue) drop(lines int) {
+	if lines <= 0 {
+		return
+	}
+	tq.dropped += lines
+	tq.droppedTotal += lines
+	tailDroppedLines.WithLabelValues(tq.buf.policy).Add(float64(lines))
+}
+
+// close wakes up pop after all the frames are pushed
+func (tq *tailQueue) close() {
+	tq.mu.Lock()
+	tq.closed = true
+	tq.cond.Broadcast()
+	tq.mu.Unlock()
+}
+
+// pop returns the next frame to send, it returns false when the queue is closed and empty.
+// The notice about dropped lines is returned at most once per tailDropNoticeInterval.
+func (tq *tailQueue) pop() (*data.Frame, bool) {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	for len(tq.frames) == 0 && !tq.closed {
+		tq.cond.Wait()
+	}
+
+	if tq.dropped > 0 && time.Since(tq.lastNotice) >= tailDropNoticeInterval {
+		backend.Logger.Warn("live stream client is too slow, lines dropped", "path", tq.path, "policy", tq.buf.policy,
+			"dropped", tq.dropped, "droppedTotal", tq.droppedTotal)
+		notice := newTailNoticeFrame("%d lines dropped because the client can't keep up with the live stream", tq.dropped)
+		tq.dropped = 0
+		tq.lastNotice = time.Now()
+		return notice, true
+	}
+
+	if len(tq.frames) == 0 {
+		return nil, false
+	}
+	frame := tq.frames[0]
+	tq.frames[0] = nil
+	tq.frames = tq.frames[1:]
+	tq.cond.Broadcast()
+	return frame, true
+}
+
+// sampleFrame returns the copy of the frame with every n-th row
+func sampleFrame(frame *data.Frame, n int) *data.Frame {
+	return filterFrameRows(frame, func(i int) bool { return i%n == 0 })
+}
+
+// filterFrameRows returns the copy of the frame with the rows for which keep returns true
+func filterFrameRows(frame *data.Frame, keep func(i int) bool) *data.Frame {
+	filtered := frame.EmptyCopy()
+	for i := 0; i < frame.Rows(); i++ {
+		if keep(i) {
+			filtered.AppendRow(frame.RowCopy(i)...)
+		}
+	}
+
+	// stream ids and streams of the log frames are stored per row in the meta
+	if frame.Meta != nil {
+		if custom, ok := frame.Meta.Custom.(map[string]any); ok {
+			filteredCustom := make(map[string]any, len(custom))
+			for k, v := range custom {
+				switch vs := v.(type) {
+				case []string:
+					filteredCustom[k] = filterSlice(vs, keep)
+				case []map[string]string:
+					filteredCustom[k] = filterSlice(vs, keep)
+				default:
+					filteredCustom[k] = v
+				}
+			}
+			meta := *frame.Meta
+			meta.Custom = filteredCustom
+			filtered.Meta = &meta
+		}
+	}
+	return filtered
+}
+
+func filterSlice[T any](s []T, keep func(i int) bool) []T {
+	filtered := make([]T, 0, len(s))
+	for i := range s {
+		if keep(i) {
+			filtered = append(filtered, s[i])
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTailQueue(t *testing.T) {
+	type opts struct {
+		policy      string
+		size        int
+		frameRows   []int
+		wantRows    []int
+		wantNotice  string
+		wantDropped float64
+	}
+	newFrame := func(rows int) *data.Frame {
+		lf := newLogFrame()
+		for i := 0; i < rows; i++ {
+			lf.append(logRow{Time: time.Unix(int64(i), 0), Line: "line", ID: "id", StreamID: "stream"})
+		}
+		return lf.streamFrame()
+	}
+	f := func(opts opts) {
+		t.Helper()
+		droppedBefore := tailDroppedLinesValue(t, opts.policy)
+		tq := newTailQueue("path", tailBuffer{size: opts.size, policy: opts.policy})
+		for _, rows := range opts.frameRows {
+			tq.push(newFrame(rows))
+		}
+		tq.close()
+
+		var gotRows []int
+		var gotNotice string
+		for {
+			frame, ok := tq.pop()
+			if !ok {
+				break
+			}
+			if frame.Meta != nil && len(frame.Meta.Notices) > 0 {
+				gotNotice = frame.Meta.Notices[0].Text
+				continue
+			}
+			gotRows = append(gotRows, frame.Rows())
+			if ids := frame.Meta.Custom.(map[string]any)["streamIds"].([]string); len(ids) != frame.Rows() {
+				t.Fatalf("expected %d stream ids, got %d", frame.Rows(), len(ids))
+			}
+		}
+		if !reflect.DeepEqual(gotRows, opts.wantRows) {
+			t.Fatalf("unexpected frames: got %v, want %v", gotRows, opts.wantRows)
+		}
+		if gotNotice != opts.wantNotice {
+			t.Fatalf("unexpected notice: got %q, want %q", gotNotice, opts.wantNotice)
+		}
+		if got := tailDroppedLinesValue(t, opts.policy) - droppedBefore; got != opts.wantDropped {
+			t.Fatalf("unexpected dropped lines metric: got %v, want %v", got, opts.wantDropped)
+		}
+	}
+
+	// oldest frames are dropped
+	o := opts{
+		policy:      tailPolicyDropOldest,
+		size:        2,
+		frameRows:   []int{1, 2, 3, 4},
+		wantRows:    []int{3, 4},
+		wantNotice:  "3 lines dropped because the client can't keep up with the live stream",
+		wantDropped: 3,
+	}
+	f(o)
+
+	// frames are sampled when the buffer is half full and dropped when it is full
+	o = opts{
+		policy:      tailPolicySample,
+		size:        4,
+		frameRows:   []int{20, 20, 20, 20, 20},
+		wantRows:    []int{20, 20, 2, 2},
+		wantNotice:  "56 lines dropped because the client can't keep up with the live stream",
+		wantDropped: 56,
+	}
+	f(o)
+
+	// nothing is dropped if the buffer isn't full
+	o = opts{
+		policy:    tailPolicyDropOldest,
+		size:      10,
+		frameRows: []int{1, 2},
+		wantRows:  []int{1, 2},
+	}
+	f(o)
+}
+
+// tailDroppedLinesValue returns the value of the dropped lines metric for the policy
+func tailDroppedLinesValue(t *testing.T, policy string) float64 {
+	t.Helper()
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %s", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "victorialogs_datasource_tail_dropped_lines_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "policy" && l.GetValue() == policy {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestTailQueueBlock(t *testing.T) {
+	tq := newTailQueue("path", tailBuffer{size: 1, policy: tailPolicyBlock})
+	tq.push(data.NewFrame("first"))
+
+	pushed := make(chan struct{})
+	go func() {
+		tq.push(data.NewFrame("second"))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatalf("expected push to wait for the free space")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if frame, _ := tq.pop(); frame.Name != "first" {
+		t.Fatalf("unexpected frame %q", frame.Name)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected push to finish after pop")
+	}
+	if frame, _ := tq.pop(); frame.Name != "second" {
+		t.Fatalf("unexpected frame %q", frame.Name)
+	}
+}
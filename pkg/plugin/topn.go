@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"sort"
+	"time"
+)
+
+// otherSeriesValue is set to every label of the series
+// which contains the sum of series not included into the top N
+const otherSeriesValue = "__other__"
+
+// splitTopN returns indexes of the n series with the largest totals ordered by total
+// and indexes of the rest series in the original order
+func splitTopN(totals []float64, n int) (top, rest []int) {
+	idx := make([]int, len(totals))
+	for i := range idx {
+		idx[i] = i
+	}
+	if n <= 0 || len(totals) <= n {
+		return idx, nil
+	}
+
+	sort.SliceStable(idx, func(i, j int) bool {
+		return totals[idx[i]] > totals[idx[j]]
+	})
+	top = idx[:n]
+	rest = append(rest, idx[n:]...)
+	sort.Ints(rest)
+	return top, rest
+}
+
+// otherLabels returns labels for the series which merges the given series.
+// All label names are kept with the otherSeriesValue value except the keep label,
+// which is the same for all merged series.
+func otherLabels(labels []map[string]string, keep string) map[string]string {
+	result := make(map[string]string)
+	for _, ls := range labels {
+		for k, v := range ls {
+			if k == keep {
+				result[k] = v
+				continue
+			}
+			result[k] = otherSeriesValue
+		}
+	}
+	return result
+}
+
+// sumByTime sums values of the given series with equal timestamps.
+// The returned series is sorted by time.
+func sumByTime(timestamps [][]time.Time, values [][]float64) ([]time.Time, []float64) {
+	sums := make(map[int64]float64)
+	for i := range timestamps {
+		for j, ts := range timestamps[i] {
+			sums[ts.UnixNano()] += values[i][j]
+		}
+	}
+
+	keys := make([]int64, 0, len(sums))
+	for k := range sums {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	ts := make([]time.Time, len(keys))
+	vs := make([]float64, len(keys))
+	for i, k := range keys {
+		ts[i] = time.Unix(0, k).UTC()
+		vs[i] = sums[k]
+	}
+	return ts, vs
+}
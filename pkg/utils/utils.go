@@ -495,6 +495,21 @@ func CalculateStep(minInterval time.Duration, timeRange backend.TimeRange, maxDa
 	return roundInterval(calculatedInterval)
 }
 
+// AlignTime returns the start of the step bucket containing t.
+// Positive offset moves bucket boundaries back in time the same way as the `offset`
+// param of VictoriaLogs, e.g. offset 2h aligns daily buckets to the midnight of UTC+2.
+func AlignTime(t time.Time, step, offset time.Duration) time.Time {
+	if step <= 0 {
+		return t
+	}
+	ns := t.UnixNano() + int64(offset)
+	rem := ns % int64(step)
+	if rem < 0 {
+		rem += int64(step)
+	}
+	return time.Unix(0, ns-rem-int64(offset)).UTC()
+}
+
 // WithIntervalVariable checks if the expression contains interval variable
 func WithIntervalVariable(expr string) bool {
 	return expr == varInterval
@@ -822,3 +822,29 @@ func TestRoundInterval(t *testing.T) {
 		})
 	}
 }
+
+func TestAlignTime(t *testing.T) {
+	f := func(ts time.Time, step, offset time.Duration, want time.Time) {
+		t.Helper()
+		if got := AlignTime(ts, step, offset); !got.Equal(want) {
+			t.Errorf("AlignTime() = %v, want %v", got, want)
+		}
+	}
+
+	ts := time.Date(2024, 1, 1, 10, 7, 33, 0, time.UTC)
+
+	// zero step keeps time as is
+	f(ts, 0, 0, ts)
+
+	// minute buckets
+	f(ts, time.Minute, 0, time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC))
+
+	// daily buckets in UTC+2 start at 22:00 UTC
+	f(ts, 24*time.Hour, 2*time.Hour, time.Date(2023, 12, 31, 22, 0, 0, 0, time.UTC))
+
+	// daily buckets in UTC-5:30 start at 05:30 UTC
+	f(ts, 24*time.Hour, -(5*time.Hour + 30*time.Minute), time.Date(2024, 1, 1, 5, 30, 0, 0, time.UTC))
+
+	// time before the epoch
+	f(time.Unix(-90, 0), time.Minute, 0, time.Unix(-120, 0).UTC())
+}
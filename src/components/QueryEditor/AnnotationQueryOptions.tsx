@@ -0,0 +1,92 @@
+import React from 'react';
+
+import { AutoSizeInput, Switch } from '@grafana/ui';
+
+import { AnnotationOptions, Query } from '../../types';
+
+import EditorField from './EditorField';
+
+interface Props {
+  query: Query;
+  onChange: (update: Query) => void;
+  onRunQuery: () => void;
+}
+
+export const AnnotationQueryOptions = ({ query, onChange, onRunQuery }: Props) => {
+  const annotation = query.annotation ?? {};
+
+  const onOptionChange = (update: Partial<AnnotationOptions>) => {
+    onChange({ ...query, annotation: { ...annotation, ...update } });
+    onRunQuery();
+  };
+
+  const onTagFieldsChange = (e: React.FormEvent<HTMLInputElement>) => {
+    const tagFields = e.currentTarget.value.split(',').map((v) => v.trim()).filter(Boolean);
+    onOptionChange({ tagFields });
+  };
+
+  return (
+    <>
+      <EditorField label='Title field' tooltip='Log field used as the annotation title.'>
+        <AutoSizeInput
+          placeholder='field'
+          type='string'
+          minWidth={10}
+          defaultValue={annotation.titleField}
+          onCommitChange={(e) => onOptionChange({ titleField: e.currentTarget.value.trim() })}
+        />
+      </EditorField>
+      <EditorField
+        label='Text'
+        tooltip='Annotation text template. Supports the same syntax as the legend, e.g. {{level | upper}}: {{_msg}}. Log fields and stream labels can be used.'
+      >
+        <AutoSizeInput
+          placeholder='{{_msg}}'
+          type='string'
+          minWidth={14}
+          defaultValue={annotation.textTemplate}
+          onCommitChange={(e) => onOptionChange({ textTemplate: e.currentTarget.value })}
+        />
+      </EditorField>
+      <EditorField label='Tags' tooltip='Comma-separated log fields which values are used as annotation tags.'>
+        <AutoSizeInput
+          placeholder='field1, field2'
+          type='string'
+          minWidth={14}
+          defaultValue={annotation.tagFields?.join(', ')}
+          onCommitChange={onTagFieldsChange}
+        />
+      </EditorField>
+      <EditorField label='Stream tags' tooltip='Add values of the stream labels to annotation tags.'>
+        <Switch
+          value={annotation.streamTags ?? false}
+          onChange={(e) => onOptionChange({ streamTags: e.currentTarget.checked })}
+        />
+      </EditorField>
+      <EditorField
+        label='End time field'
+        tooltip='Log field with the end time of the annotation. Annotations with the end time are shown as regions.'
+      >
+        <AutoSizeInput
+          placeholder='field'
+          type='string'
+          minWidth={10}
+          defaultValue={annotation.timeEndField}
+          onCommitChange={(e) => onOptionChange({ timeEndField: e.currentTarget.value.trim() })}
+        />
+      </EditorField>
+      <EditorField
+        label='Duration field'
+        tooltip='Log field with the duration of the annotation in seconds or in the duration format, e.g. 1m30s. It is used if the end time field is missing.'
+      >
+        <AutoSizeInput
+          placeholder='field'
+          type='string'
+          minWidth={10}
+          defaultValue={annotation.durationField}
+          onCommitChange={(e) => onOptionChange({ durationField: e.currentTarget.value.trim() })}
+        />
+      </EditorField>
+    </>
+  );
+};
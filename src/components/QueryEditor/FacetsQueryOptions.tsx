@@ -0,0 +1,61 @@
+import React from 'react';
+
+import { AutoSizeInput, Switch } from '@grafana/ui';
+
+import { FacetsOptions, Query } from '../../types';
+
+import EditorField from './EditorField';
+
+interface Props {
+  query: Query;
+  onChange: (update: Query) => void;
+  onRunQuery: () => void;
+}
+
+const parseLimit = (value: string): number | undefined => {
+  const parsed = parseInt(value, 10);
+  return isNaN(parsed) || parsed <= 0 ? undefined : parsed;
+};
+
+export const FacetsQueryOptions = ({ query, onChange, onRunQuery }: Props) => {
+  const facets = query.facets ?? {};
+
+  const onOptionChange = (update: Partial<FacetsOptions>) => {
+    onChange({ ...query, facets: { ...facets, ...update } });
+    onRunQuery();
+  };
+
+  return (
+    <>
+      <EditorField label='Values per field' tooltip='Number of the most frequent values returned per field.'>
+        <AutoSizeInput
+          placeholder='10'
+          type='number'
+          min={1}
+          minWidth={8}
+          defaultValue={facets.limit}
+          onCommitChange={(e) => onOptionChange({ limit: parseLimit(e.currentTarget.value) })}
+        />
+      </EditorField>
+      <EditorField
+        label='Max unique values'
+        tooltip='Fields with more unique values, e.g. trace ids, are skipped.'
+      >
+        <AutoSizeInput
+          placeholder='1000'
+          type='number'
+          min={1}
+          minWidth={8}
+          defaultValue={facets.maxValuesPerField}
+          onCommitChange={(e) => onOptionChange({ maxValuesPerField: parseLimit(e.currentTarget.value) })}
+        />
+      </EditorField>
+      <EditorField label='Const fields' tooltip='Return fields with a single value in all matching logs.'>
+        <Switch
+          value={facets.keepConstFields ?? false}
+          onChange={(e) => onOptionChange({ keepConstFields: e.currentTarget.checked })}
+        />
+      </EditorField>
+    </>
+  );
+};
@@ -6,11 +6,14 @@ import { AutoSizeInput, Input, RadioButtonGroup, Switch, TextLink } from '@grafa
 import { VICTORIA_LOGS_DOCS_HOST } from '../../conf';
 import { LOGS_LIMIT_HARD_CAP, LOGS_LIMIT_WARNING_THRESHOLD } from '../../constants';
 import { resolveAdHocFiltersMode } from '../../datasource';
-import { AdHocFiltersMode, Query, QueryType } from '../../types';
+import { ANNOTATIONS_REF_ID } from '../../transformers/types';
+import { AdHocFiltersMode, Format, Query, QueryType } from '../../types';
 import { isVariable } from '../../utils/isVariable';
 import { useMaxLinesWarning } from '../shared/shared/useMaxLinesWarning';
 
+import { AnnotationQueryOptions } from './AnnotationQueryOptions';
 import EditorField from './EditorField';
+import { FacetsQueryOptions } from './FacetsQueryOptions';
 import { EditorRow } from './EditorRow';
 import QueryEditorOptionsGroup from './QueryEditorOptionsGroup';
 
@@ -39,6 +42,18 @@ export const queryTypeOptions: Array<SelectableValue<QueryType>> = [
     label: 'Instant',
     description: 'Use `/select/logsql/stats_query` for querying log stats at the given time.'
   },
+  {
+    value: QueryType.Facets,
+    label: 'Facets',
+    filter: ({ app }: Props) => app !== CoreApp.UnifiedAlerting && app !== CoreApp.CloudAlerting,
+    description: 'Use `/select/logsql/facets` for querying the most frequent values per log field.'
+  },
+  {
+    value: QueryType.Annotations,
+    label: 'Annotations',
+    filter: ({ query }: Props) => query.refId === ANNOTATIONS_REF_ID,
+    description: 'Use `/select/logsql/query` and map logs to annotation events with regions and tags at the backend.'
+  },
 ];
 
 const adHocFiltersModeOptions: Array<SelectableValue<AdHocFiltersMode>> = [
@@ -47,8 +62,27 @@ const adHocFiltersModeOptions: Array<SelectableValue<AdHocFiltersMode>> = [
   { value: AdHocFiltersMode.Off, label: 'Off' },
 ];
 
+const formatOptions: Array<SelectableValue<Format | ''>> = [
+  {
+    value: '',
+    label: 'Auto',
+    description: 'Series of the `histogram` stats function are converted into a heatmap by the browser.',
+  },
+  {
+    value: 'table',
+    label: 'Table',
+    filter: ({ query }: Props) => query.queryType === QueryType.Stats,
+    description: 'A single row with a column per stats result and label set.',
+  },
+  {
+    value: 'histogram',
+    label: 'Histogram',
+    description: 'Convert series of the `histogram` stats function into heatmap cells at the backend.',
+  },
+];
+
 export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onChange, onRunQuery }) => {
-  const filteredOptions = queryTypeOptions.filter(option => option.filter?.({ app }) ?? true);
+  const filteredOptions = queryTypeOptions.filter(option => option.filter?.({ app, query }) ?? true);
   const queryType = query.queryType;
 
   const isValidStep = useMemo(() => {
@@ -87,7 +121,9 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
   };
 
   const onQueryTypeChange = (value: QueryType) => {
-    onChange({ ...query, queryType: value });
+    // the table format is supported only by instant stats queries
+    const format = query.format === 'table' && value !== QueryType.Stats ? undefined : query.format;
+    onChange({ ...query, queryType: value, format });
     onRunQuery();
   };
 
@@ -106,6 +142,26 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
     onRunQuery();
   };
 
+  const onLiveChange = (e: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...query, live: e.currentTarget.checked || undefined });
+    onRunQuery();
+  };
+
+  const onTailBackfillChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    onChange({ ...query, tailBackfill: e.currentTarget.value.trim() || undefined });
+  };
+
+  const onFormatChange = (value: Format | '') => {
+    const format = value || undefined;
+    onChange({ ...query, format, histogramCumulative: format === 'histogram' ? query.histogramCumulative : undefined });
+    onRunQuery();
+  };
+
+  const onHistogramCumulativeChange = (e: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...query, histogramCumulative: e.currentTarget.checked || undefined });
+    onRunQuery();
+  };
+
   const onAdHocFiltersModeChange = (value: AdHocFiltersMode) => {
     onChange({ ...query, adHocFiltersMode: value, isApplyExtraFiltersToRootQuery: undefined });
     onRunQuery();
@@ -120,7 +176,7 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
       >
         <EditorField
           label='Legend'
-          tooltip='Series name override or template. Ex. {{hostname}} will be replaced with label value for hostname.'
+          tooltip='Series name override or template. Ex. {{hostname}} will be replaced with label value for hostname. Supports default values {{hostname | "unknown"}}, functions upper, lower, truncate N and replace "regex" "replacement". Use __auto to build the name from the stats result name and the labels of the by (...) clause.'
         >
           <AutoSizeInput
             placeholder='{{label}}'
@@ -174,6 +230,20 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
             />
           </EditorField>
         )}
+        {queryType === QueryType.Instant && app === CoreApp.Explore && (
+          <EditorField
+            label='Live backfill'
+            tooltip='Logs shown when the live mode starts: a time window, e.g. 5m, or a number of the most recent log lines, e.g. 100.'
+          >
+            <AutoSizeInput
+              className='width-6'
+              placeholder='off'
+              type='string'
+              defaultValue={query.tailBackfill ?? ''}
+              onCommitChange={onTailBackfillChange}
+            />
+          </EditorField>
+        )}
         {queryType === QueryType.StatsRange && (
           <EditorField
             label='Step'
@@ -190,6 +260,43 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
             />
           </EditorField>
         )}
+        {isStatsQueryType(queryType) && (
+          <EditorField label='Format'>
+            <RadioButtonGroup
+              options={formatOptions.filter(option => option.filter?.({ app, query }) ?? true)}
+              value={query.format ?? ''}
+              onChange={onFormatChange}
+            />
+          </EditorField>
+        )}
+        {isStatsQueryType(queryType) && query.format === 'histogram' && (
+          <EditorField
+            label='Cumulative'
+            tooltip='Make bucket counts cumulative, so every bucket contains the counts of the lower buckets.'
+          >
+            <Switch
+              value={query.histogramCumulative ?? false}
+              onChange={onHistogramCumulativeChange}
+            />
+          </EditorField>
+        )}
+        {queryType === QueryType.StatsRange && app !== CoreApp.Explore && (
+          <EditorField
+            label='Live'
+            tooltip='Stream the query: it is executed on every step over the dashboard time range and only new or updated buckets are sent to the panel.'
+          >
+            <Switch
+              value={query.live ?? false}
+              onChange={onLiveChange}
+            />
+          </EditorField>
+        )}
+        {queryType === QueryType.Facets && (
+          <FacetsQueryOptions query={query} onChange={onChange} onRunQuery={onRunQuery} />
+        )}
+        {queryType === QueryType.Annotations && (
+          <AnnotationQueryOptions query={query} onChange={onChange} onRunQuery={onRunQuery} />
+        )}
         {app !== CoreApp.Explore && (
           <EditorField
             label='Ad-hoc filters'
@@ -210,6 +317,10 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
 
 QueryEditorOptions.displayName = 'QueryEditorOptions';
 
+function isStatsQueryType(queryType?: string): boolean {
+  return queryType === QueryType.Stats || queryType === QueryType.StatsRange;
+}
+
 interface CollapsedInfoProps {
   app?: CoreApp;
   query: Query;
@@ -230,6 +341,11 @@ function getCollapsedInfo({ app, query, queryType, maxLines, isValidStep }: Coll
     items.push(`Step: ${isValidStep ? query.step : 'Invalid value'}`);
   }
 
+  if (isStatsQueryType(queryType) && query.format) {
+    const formatLabel = formatOptions.find(option => option.value === query.format)?.label ?? query.format;
+    items.push(`Format: ${formatLabel}`);
+  }
+
   if (queryType === QueryType.Instant && maxLines) {
     items.push(`Line limit: ${query.maxLines ?? maxLines}`);
   }
@@ -181,6 +181,7 @@ export const DerivedField = (props: Props) => {
                 onChange({
                   ...value,
                   datasourceUid: undefined,
+                  datasourceType: undefined,
                 });
               }
               setShowInternalLink(checked);
@@ -196,6 +197,7 @@ export const DerivedField = (props: Props) => {
                 onChange({
                   ...value,
                   datasourceUid: ds.uid,
+                  datasourceType: ds.type,
                 })
               }
               current={value.datasourceUid}
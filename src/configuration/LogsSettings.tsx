@@ -1,13 +1,23 @@
 import React, { SyntheticEvent, useMemo } from 'react';
 
 import { SelectableValue } from '@grafana/data';
-import { InlineField, Input, Stack, Text } from '@grafana/ui';
+import { InlineField, InlineSwitch, Input, Select, Stack, Text } from '@grafana/ui';
 
-import { Options } from '../types';
+import { Options, TailDropPolicy } from '../types';
 
 import { PropsConfigEditor } from './ConfigEditor';
 import { getValueFromEventItem } from './utils';
 
+const tailDropPolicyOptions: Array<SelectableValue<TailDropPolicy>> = [
+  {
+    value: 'block',
+    label: 'Block',
+    description: 'Wait for the browser, VictoriaLogs buffers new log lines. Shared tails drop the oldest lines instead',
+  },
+  { value: 'dropOldest', label: 'Drop oldest', description: 'Drop the oldest buffered log lines' },
+  { value: 'sample', label: 'Sample', description: 'Keep every 10th log line when the buffer is half full' },
+];
+
 export const getDefaultVmuiUrl = (serverUrl = '') => `${serverUrl.replace(/\/$/, '')}/select/vmui/#/`;
 
 export const LogsSettings = (props: PropsConfigEditor) => {
@@ -38,6 +48,150 @@ export const LogsSettings = (props: PropsConfigEditor) => {
             />
           </InlineField>
         </div>
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Live tail batch size'
+            labelWidth={28}
+            tooltip='Max number of log lines sent to the browser in a single frame in the Live mode. Default is 100.'
+          >
+            <Input
+              className='width-25'
+              type='number'
+              min={1}
+              value={optionsWithHttpMethod.jsonData.tailBatchSize ?? ''}
+              onChange={(e) => onOptionsChange({
+                ...optionsWithHttpMethod,
+                jsonData: {
+                  ...optionsWithHttpMethod.jsonData,
+                  tailBatchSize: e.currentTarget.value ? Number(e.currentTarget.value) : undefined,
+                },
+              })}
+              placeholder='100'
+            />
+          </InlineField>
+        </div>
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Live tail flush interval'
+            labelWidth={28}
+            tooltip='Max time the log lines are buffered before they are sent to the browser in the Live mode. Default is 250ms.'
+          >
+            <Input
+              className='width-25'
+              value={optionsWithHttpMethod.jsonData.tailFlushInterval}
+              onChange={onChangeHandler('tailFlushInterval', optionsWithHttpMethod, onOptionsChange)}
+              spellCheck={false}
+              placeholder='250ms'
+            />
+          </InlineField>
+        </div>
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Live tail buffer size'
+            labelWidth={28}
+            tooltip='Max number of frames buffered for the browser which cannot keep up with the Live mode. Default is 100.'
+          >
+            <Input
+              className='width-25'
+              type='number'
+              min={1}
+              value={optionsWithHttpMethod.jsonData.tailBufferSize ?? ''}
+              onChange={(e) => onOptionsChange({
+                ...optionsWithHttpMethod,
+                jsonData: {
+                  ...optionsWithHttpMethod.jsonData,
+                  tailBufferSize: e.currentTarget.value ? Number(e.currentTarget.value) : undefined,
+                },
+              })}
+              placeholder='100'
+            />
+          </InlineField>
+        </div>
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Live tail drop policy'
+            labelWidth={28}
+            tooltip='What to do when the buffer of the Live mode is full. The browser is notified about dropped log lines.'
+          >
+            <Select
+              className='width-25'
+              options={tailDropPolicyOptions}
+              value={optionsWithHttpMethod.jsonData.tailDropPolicy ?? 'block'}
+              onChange={onChangeHandler('tailDropPolicy', optionsWithHttpMethod, onOptionsChange)}
+            />
+          </InlineField>
+        </div>
+        {(optionsWithHttpMethod.jsonData.tailDropPolicy ?? 'block') === 'block' && (
+          <div className='gf-form max-width-30'>
+            <Text variant='bodySmall' color='warning'>
+              Live streams with the same query share a single tail connection, which cannot wait for a single slow
+              browser. With the Block policy, the oldest buffered log lines of a slow browser are dropped, like with
+              the Drop oldest policy.
+            </Text>
+          </div>
+        )}
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Disable Live mode'
+            labelWidth={28}
+            tooltip='Reject all Live mode queries of the data source, e.g. to protect VictoriaLogs from long-running tail requests.'
+          >
+            <InlineSwitch
+              value={optionsWithHttpMethod.jsonData.disableLiveMode}
+              onChange={(e) => onOptionsChange({
+                ...optionsWithHttpMethod,
+                jsonData: {
+                  ...optionsWithHttpMethod.jsonData,
+                  disableLiveMode: e.currentTarget.checked,
+                },
+              })}
+            />
+          </InlineField>
+        </div>
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Max Live streams'
+            labelWidth={28}
+            tooltip='Max number of concurrent Live mode queries of the data source. Default is 100.'
+          >
+            <Input
+              className='width-25'
+              type='number'
+              min={1}
+              value={optionsWithHttpMethod.jsonData.maxLiveStreams ?? ''}
+              onChange={(e) => onOptionsChange({
+                ...optionsWithHttpMethod,
+                jsonData: {
+                  ...optionsWithHttpMethod.jsonData,
+                  maxLiveStreams: e.currentTarget.value ? Number(e.currentTarget.value) : undefined,
+                },
+              })}
+              placeholder='100'
+            />
+          </InlineField>
+        </div>
+        <div className='gf-form max-width-30'>
+          <InlineField
+            label='Max Live streams per user'
+            labelWidth={28}
+            tooltip='Max number of concurrent Live mode queries of a single user. Default is 10.'
+          >
+            <Input
+              className='width-25'
+              type='number'
+              min={1}
+              value={optionsWithHttpMethod.jsonData.maxLiveStreamsPerUser ?? ''}
+              onChange={(e) => onOptionsChange({
+                ...optionsWithHttpMethod,
+                jsonData: {
+                  ...optionsWithHttpMethod.jsonData,
+                  maxLiveStreamsPerUser: e.currentTarget.value ? Number(e.currentTarget.value) : undefined,
+                },
+              })}
+              placeholder='10'
+            />
+          </InlineField>
+        </div>
         <div className='gf-form max-width-30'>
           <InlineField
             label='Link on vmui'
@@ -49,7 +49,6 @@ import { LOGS_VOLUME_BARS, queryLogsVolume } from './logsVolumeLegacy';
 import {
   addLabelToQuery,
   addSortPipeToQuery,
-  getQueryFormat,
 } from './modifyQuery';
 import { removeDoubleQuotesAroundVar } from './parsing';
 import { replaceOperatorWithIn, returnVariables } from './parsingUtils';
@@ -70,6 +69,7 @@ import {
   TenantHeaderNames,
   ToggleFilterAction,
   VariableQuery,
+  VictoriaLogsCapabilities,
 } from './types';
 import {
   resolveAdHocFilters,
@@ -149,7 +149,6 @@ export class VictoriaLogsDatasource
           expr: addSortPipeToQuery(q, request.app, request.liveStreaming),
           maxLines: Math.min(q.maxLines ?? this.maxLines, LOGS_LIMIT_HARD_CAP),
           timezoneOffset,
-          format: getQueryFormat(q.expr),
           step: this.templateSrv.replace(q.step, request.scopedVars),
         };
       });
@@ -162,6 +161,16 @@ export class VictoriaLogsDatasource
       return this.runLiveQueryThroughBackend(request);
     }
 
+    const liveQueries = queries.filter(isLiveStatsQuery);
+    if (liveQueries.length) {
+      const otherQueries = queries.filter((q) => !isLiveStatsQuery(q));
+      const observables = [this.runLiveQueryThroughBackend({ ...request, targets: liveQueries })];
+      if (otherQueries.length) {
+        observables.push(this.runQuery({ ...request, targets: otherQueries }));
+      }
+      return merge(...observables);
+    }
+
     return this.runQuery(request);
   }
 
@@ -441,6 +450,9 @@ export class VictoriaLogsDatasource
             path,
             data: {
               ...query,
+              // the sliding window of the live stats queries
+              liveWindow: query.liveWindow || `${Math.round(request.range.to.diff(request.range.from) / 1000)}s`,
+              intervalMs: request.intervalMs,
             },
           },
         })
@@ -602,6 +614,15 @@ export class VictoriaLogsDatasource
     }
   }
 
+  async fetchCapabilities(): Promise<VictoriaLogsCapabilities | null> {
+    try {
+      return await this.getResource<VictoriaLogsCapabilities>('capabilities');
+    } catch (error) {
+      console.error('Failed to fetch VictoriaLogs capabilities:', error);
+      return null;
+    }
+  }
+
   parseMultitenancyHeaders(multitenancyHeaders?: Partial<Record<TenantHeaderNames, string>>): MultitenancyHeaders {
     const formatTenantId = (value: string | number | undefined): string => {
       if (value === undefined || value === '') {
@@ -618,3 +639,6 @@ export class VictoriaLogsDatasource
   }
 }
 
+const isLiveStatsQuery = (query: Query): boolean => {
+  return Boolean(query.live) && (query.queryType === QueryType.StatsRange || query.queryType === QueryType.Hits);
+};
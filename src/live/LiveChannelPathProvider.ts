@@ -8,13 +8,18 @@ interface ChannelState {
 }
 
 /**
- * Serializes the query fields that affect the backend live tail request
+ * Serializes the query fields that affect the backend live tail or live stats request
  */
 function serializeLiveQuery(query: Query): string {
   return JSON.stringify({
     expr: query.expr,
     extraFilters: query.extraFilters,
     extraStreamFilters: query.extraStreamFilters,
+    queryType: query.queryType,
+    step: query.step,
+    fields: query.fields,
+    tailBackfill: query.tailBackfill,
+    liveWindow: query.liveWindow,
   });
 }
 
@@ -222,4 +222,46 @@ describe('LogContextProvider', () => {
 
     expect(query?.expr).toBe('_stream_id:"stream-id-2" _time:<=2023-11-14T22:13:20.000123456Z | sort by (_time) desc limit 50');
   });
+
+  describe('getLogRowContext', () => {
+    const rows = [
+      { time: '', timeNs: '1700000000000123455', line: 'before', id: 'b', labels: {} },
+      { time: '', timeNs: '1700000000000123456', line: 'tie before', id: 't1', labels: {} },
+      { time: '', timeNs: '1700000000000123456', line: 'anchor', id: 't2', labels: {}, anchor: true },
+      { time: '', timeNs: '1700000000000123456', line: 'tie after', id: 't3', labels: {} },
+      { time: '', timeNs: '1700000000000123457', line: 'after', id: 'a', labels: {}, streamId: 'stream-id-1' },
+    ];
+
+    const runContext = async (direction: LogRowContextQueryDirection) => {
+      const datasource = (provider as any).datasource;
+      const postResource = jest.spyOn(datasource, 'postResource').mockResolvedValue({ rows });
+      const res = await provider.getLogRowContext(buildLogRow({ rowId: 't2' }), { direction, limit: 10 });
+      const calls = [...postResource.mock.calls];
+      postResource.mockRestore();
+      return { res, calls };
+    };
+
+    it('requests the context split at the anchor row', async () => {
+      const { calls } = await runContext(LogRowContextQueryDirection.Backward);
+      expect(calls).toEqual([['log_context', {
+        streamId: 'stream-id-1',
+        time: '2023-11-14T22:13:20.000123456Z',
+        id: 't2',
+        limit: 10,
+      }]]);
+    });
+
+    it('returns rows before the anchor newest first for the backward direction', async () => {
+      const { res } = await runContext(LogRowContextQueryDirection.Backward);
+      expect(res.data[0].fields[1].values).toEqual(['tie before', 'before']);
+      expect(res.data[0].fields[0].values).toEqual([1700000000000, 1700000000000]);
+      expect(res.data[0].fields[0].nanos).toEqual([123456, 123455]);
+    });
+
+    it('returns rows after the anchor oldest first for the forward direction', async () => {
+      const { res } = await runContext(LogRowContextQueryDirection.Forward);
+      expect(res.data[0].fields[1].values).toEqual(['tie after', 'after']);
+      expect(res.data[0].meta?.custom?.streamIds).toEqual(['', 'stream-id-1']);
+    });
+  });
 });
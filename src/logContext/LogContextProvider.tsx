@@ -1,16 +1,11 @@
 import React, { ReactNode } from 'react';
-import { lastValueFrom } from 'rxjs';
 
 import {
-  CoreApp,
-  DataQueryRequest,
   DataFrame,
+  FieldType,
   LogRowContextOptions,
   LogRowContextQueryDirection,
   LogRowModel,
-  rangeUtil,
-  TimeRange,
-  toUtc,
 } from '@grafana/data';
 
 import type { VictoriaLogsDatasource } from '../datasource';
@@ -20,7 +15,6 @@ import { formatNanosEpochToISO } from '../utils/timeUtils';
 
 import { LogContextUI } from './components/LogContextUI';
 
-export const REF_ID_STARTER_LOG_CONTEXT_REQUEST = 'log-context-request-';
 export const REF_ID_STARTER_LOG_CONTEXT_QUERY = 'log-context-query-';
 export const LABEL_STREAM_ID = '_stream_id';
 export const LABEL_STREAM = '_stream';
@@ -28,6 +22,27 @@ export const LABEL_STREAM = '_stream';
 // fallback row cap per direction when the context modal does not pass a limit
 export const LOG_CONTEXT_DEFAULT_LIMIT = 50;
 
+// a row returned by the backend `log_context` resource, rows are sorted by time
+// with the stable order of rows with the same timestamp
+interface LogContextRow {
+  time: string;
+  timeNs: string;
+  line: string;
+  id: string;
+  labels: Record<string, unknown>;
+  streamId?: string;
+  stream?: Record<string, string>;
+  anchor?: boolean;
+}
+
+// compares unix nanosecond-epoch strings without losing the precision of numbers
+function compareNanos(a: string, b: string): number {
+  if (a.length !== b.length) {
+    return a.length - b.length;
+  }
+  return a < b ? -1 : a > b ? 1 : 0;
+}
+
 const SIMPLE_SELECTOR_KEY_REGEXP = /^[a-zA-Z_][a-zA-Z0-9_.]*$/;
 
 // stream label names are quoted unless they are simple identifiers,
@@ -149,12 +164,76 @@ export class LogContextProvider {
     return `${filterExpr} | sort by (_time) ${sortDir} limit ${limit}`;
   };
 
+  // the stream scope of the backend `log_context` request, it follows buildContextFilterExpr
+  private getContextScope = (row: LogRowModel): { streamId?: string; stream?: Record<string, string> } => {
+    const streamId = this.getRowStreamId(row);
+    const labels = this.getStreamLabels(row);
+    const keys = Object.keys(labels);
+    const disabled = this.disabledStreamLabels.get(streamId);
+    const selected = keys.filter((key) => !disabled?.has(key));
+
+    if (streamId && (!disabled?.size || !selected.length || selected.length === keys.length)) {
+      return { streamId };
+    }
+    const scopeKeys = selected.length ? selected : keys;
+    return { stream: Object.fromEntries(scopeKeys.map((key) => [key, labels[key]])) };
+  };
+
+  // the surrounding lines are split at the exact anchor timestamp by the backend,
+  // rows with the same timestamp are placed before or after the anchor row in a stable order
   getLogRowContext = async (
     row: LogRowModel,
     options?: LogRowContextOptions,
   ): Promise<{ data: DataFrame[] }> => {
-    const contextRequest = this.makeLogContextDataRequest(row, options);
-    return lastValueFrom(this.datasource.runQuery(contextRequest));
+    const direction = options?.direction || LogRowContextQueryDirection.Backward;
+    const limit = options?.limit ?? LOG_CONTEXT_DEFAULT_LIMIT;
+    const anchorNs = row.timeEpochNs ?? `${row.timeEpochMs}000000`;
+
+    const res = await this.datasource.postResource<{ rows?: LogContextRow[] }>('log_context', {
+      ...this.getContextScope(row),
+      time: this.getAnchorTimestamp(row),
+      id: row.rowId ?? '',
+      limit,
+    });
+    const rows = res?.rows ?? [];
+
+    // without the marked anchor, rows with the anchor timestamp are returned before the split
+    const anchorIndex = rows.findIndex((r) => r.anchor);
+    const afterIndex = rows.findIndex((r) => compareNanos(r.timeNs, anchorNs) > 0);
+    const split = anchorIndex >= 0 ? anchorIndex : afterIndex >= 0 ? afterIndex : rows.length;
+    const selected = direction === LogRowContextQueryDirection.Forward
+      ? rows.slice(anchorIndex >= 0 ? anchorIndex + 1 : split)
+      : rows.slice(0, split).reverse();
+
+    return { data: [this.toLogsFrame(selected, `${REF_ID_STARTER_LOG_CONTEXT_QUERY}${row.dataFrame.refId}-${direction}`)] };
+  };
+
+  // converts rows into the same logs frame as returned by the backend for raw logs queries
+  private toLogsFrame = (rows: LogContextRow[], refId: string): DataFrame => {
+    const timesNs = rows.map((r) => r.timeNs.padStart(7, '0'));
+    return {
+      refId,
+      length: rows.length,
+      fields: [
+        {
+          name: 'Time',
+          type: FieldType.time,
+          config: {},
+          values: timesNs.map((ns) => Number(ns.slice(0, -6))),
+          nanos: timesNs.map((ns) => Number(ns.slice(-6))),
+        },
+        { name: 'Line', type: FieldType.string, config: {}, values: rows.map((r) => r.line) },
+        { name: 'id', type: FieldType.string, config: {}, values: rows.map((r) => r.id) },
+        { name: 'labels', type: FieldType.other, config: {}, values: rows.map((r) => r.labels) },
+      ],
+      meta: {
+        preferredVisualisationType: 'logs',
+        custom: {
+          streamIds: rows.map((r) => r.streamId ?? ''),
+          streams: rows.map((r) => r.stream ?? null),
+        },
+      },
+    };
   };
 
   getLogRowContextQuery = async (
@@ -172,53 +251,4 @@ export class LogContextProvider {
   getLogRowContextUi = (row: LogRowModel, runContextQuery?: () => void): ReactNode => {
     return <LogContextUI provider={this} row={row} runContextQuery={runContextQuery} />;
   };
-
-  private makeLogContextDataRequest = (row: LogRowModel, options?: LogRowContextOptions): DataQueryRequest<Query> => {
-    const direction = options?.direction || LogRowContextQueryDirection.Backward;
-    const limit = options?.limit ?? LOG_CONTEXT_DEFAULT_LIMIT;
-
-    const query: Query = {
-      expr: this.prepareLogContextQueryExpr(row, direction, limit),
-      refId: `${REF_ID_STARTER_LOG_CONTEXT_QUERY}${row.dataFrame.refId}-${direction}`
-    };
-
-    const range = this.createContextTimeRange(row.timeEpochMs, direction);
-
-    const interval = rangeUtil.calculateInterval(range, 1);
-
-    return {
-      app: CoreApp.Explore,
-      interval: interval.interval,
-      intervalMs: interval.intervalMs,
-      range: range,
-      requestId: `${REF_ID_STARTER_LOG_CONTEXT_REQUEST}${row.dataFrame.refId}-${direction}`,
-      scopedVars: {},
-      startTime: Date.now(),
-      targets: [query],
-      timezone: 'UTC'
-    };
-  };
-
-  // coarse scan window around the anchor; the exact boundary at the anchor
-  // timestamp is enforced by the `_time` filter in the query expr. The backward
-  // window still ends 1s after the anchor because the backend truncates the
-  // range start/end params to whole seconds — ending exactly at the anchor
-  // could clip the anchor's own second out of the scan window
-  private createContextTimeRange = (rowTimeEpochMs: number, direction?: LogRowContextQueryDirection): TimeRange => {
-    const offset = 2 * 60 * 60 * 1000;  // 2h
-    const overlap = 1000;
-
-    const timeRange =
-      direction === LogRowContextQueryDirection.Backward
-        ? {
-          from: toUtc(rowTimeEpochMs - offset),
-          to: toUtc(rowTimeEpochMs + overlap)
-        }
-        : {
-          from: toUtc(rowTimeEpochMs),
-          to: toUtc(rowTimeEpochMs + offset)
-        };
-
-    return { ...timeRange, raw: timeRange };
-  };
 }
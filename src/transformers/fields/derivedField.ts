@@ -7,10 +7,14 @@ import { PLUGIN_ID } from '../../constants';
 import { DerivedFieldConfig } from '../../types';
 
 export function getDerivedFields(dataFrame: DataFrame, derivedFieldConfigs: DerivedFieldConfig[]): Field[] {
-  if (!derivedFieldConfigs.length) {
+  // derived fields may already be added by the backend
+  const missingConfigs = derivedFieldConfigs.filter(
+    (config) => !dataFrame.fields.some((field) => field.name === config.name)
+  );
+  if (!missingConfigs.length) {
     return [];
   }
-  const derivedFieldsGrouped = groupBy(derivedFieldConfigs, 'name');
+  const derivedFieldsGrouped = groupBy(missingConfigs, 'name');
 
   const newFields = Object.values(derivedFieldsGrouped).map(fieldFromDerivedFieldConfig);
 
@@ -36,7 +36,7 @@ export function transformBackendResult(
 
   const queryMap = getQueryMap(queries) as Map<string, Query>;
 
-  const { streamsFrames, metricInstantFrames, metricRangeFrames, histogramFrames } = groupFrames(dataFrames, queryMap);
+  const { streamsFrames, metricInstantFrames, metricRangeFrames, histogramFrames, tableFrames } = groupFrames(dataFrames, queryMap);
 
   const improvedErrors = errors && errors.map((error) => improveError(error, queryMap)).filter((e) => e !== undefined);
 
@@ -48,6 +48,7 @@ export function transformBackendResult(
       ...processMetricInstantFrames(metricInstantFrames),
       ...processStreamsFrames(streamsFrames, queryMap, derivedFieldConfigs, logLevelRules, interpolateExpr),
       ...processHistogramFrames(histogramFrames, request.panelPluginId),
+      ...tableFrames,
     ],
   };
 }
@@ -1,5 +1,6 @@
 import { DataFrame, FieldType, Labels, QueryResultMeta } from '@grafana/data';
 
+import { getQueryFormat } from '../../../modifyQuery';
 import { Query, QueryType } from '../../../types';
 
 export function isMetricFrame(frame: DataFrame): boolean {
@@ -34,14 +35,28 @@ export function groupFrames(
   metricInstantFrames: DataFrame[];
   metricRangeFrames: DataFrame[];
   histogramFrames: DataFrame[];
+  tableFrames: DataFrame[];
 } {
   const streamsFrames: DataFrame[] = [];
   const metricInstantFrames: DataFrame[] = [];
   const metricRangeFrames: DataFrame[] = [];
   const histogramFrames: DataFrame[] = [];
+  const tableFrames: DataFrame[] = [];
 
   frames.forEach((frame) => {
-    const isHistogramFrame = frame.refId != null && queryMap.get(frame.refId)?.format === 'histogram';
+    // table, heatmap and annotation frames are fully prepared by the backend
+    if (
+      frame.meta?.preferredVisualisationType === 'table' ||
+      frame.meta?.type === 'heatmap-cells' ||
+      frame.meta?.dataTopic === 'annotations'
+    ) {
+      tableFrames.push(frame);
+      return;
+    }
+
+    // histogram series are converted by the frontend unless the backend conversion is requested via format
+    const query = frame.refId != null ? queryMap.get(frame.refId) : undefined;
+    const isHistogramFrame = query != null && getQueryFormat(query.expr) === 'histogram';
     if (isHistogramFrame) {
       histogramFrames.push(frame);
       return;
@@ -59,7 +74,7 @@ export function groupFrames(
     }
   });
 
-  return { streamsFrames, metricInstantFrames, metricRangeFrames, histogramFrames };
+  return { streamsFrames, metricInstantFrames, metricRangeFrames, histogramFrames, tableFrames };
 }
 
 export function dataFrameHasError(frame: DataFrame): boolean {
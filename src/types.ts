@@ -21,8 +21,24 @@ export interface Options extends DataSourceJsonData {
   multitenancyHeaders?: Partial<Record<TenantHeaderNames, string>>;
   vmuiUrl?: string;
   otelPreset?: OpenTelemetryPreset;
+  tailBatchSize?: number;
+  tailFlushInterval?: string;
+  tailBufferSize?: number;
+  tailDropPolicy?: TailDropPolicy;
+  disableLiveMode?: boolean;
+  maxLiveStreams?: number;
+  maxLiveStreamsPerUser?: number;
+  /** additional `/select/logsql/*` endpoints and args allowed for the resource calls */
+  proxyEndpoints?: ProxyEndpoint[];
 }
 
+export interface ProxyEndpoint {
+  path: string;
+  params?: string[];
+}
+
+export type TailDropPolicy = 'block' | 'dropOldest' | 'sample';
+
 export const QUERY_DIRECTION = {
   asc: 'asc',
   desc: 'desc',
@@ -42,6 +58,8 @@ export enum QueryType {
   Stats = 'stats', // /select/logsql/stats_query
   StatsRange = 'statsRange', // /select/logsql/stats_query_range
   Hits = 'hits', // /select/logsql/hits
+  Annotations = 'annotations', // /select/logsql/query mapped to annotation events by the backend
+  Facets = 'facets', // /select/logsql/facets or field_names with field_values for old VictoriaLogs
 }
 
 export enum QueryEditorMode {
@@ -55,7 +73,7 @@ export enum AdHocFiltersMode {
   Off = 'off',
 }
 
-export type Format = 'histogram';
+export type Format = 'histogram' | 'table';
 
 export type StreamFilterOperator = 'in';
 
@@ -101,15 +119,54 @@ export interface Query extends DataQuery {
   fields?: string[];
   /** timezone offset for bucket alignment in stats_query_range and hits endpoints (e.g. "2h", "-5h30m") */
   timezoneOffset?: string;
+  /** `per_second` divides hits bucket counts by the step */
+  normalize?: 'per_second';
+  /** adds a frame with the total number of hits per group */
+  hitsTotals?: boolean;
+  /** keeps N largest hits and stats range series, the rest are summed into the `__other__` series */
+  topN?: number;
+  /** fills every step of stats range series between start and end */
+  fill?: 'null' | 'zero' | 'previous';
   /** @deprecated Use adHocFiltersMode instead */
   isApplyExtraFiltersToRootQuery?: boolean;
   adHocFiltersMode?: AdHocFiltersMode;
-  /** shows which format of data is used */
+  /** shows which format of data is used, `histogram` converts histogram series into heatmap cells at the backend */
   format?: Format;
+  /** makes bucket counts cumulative for the `histogram` format */
+  histogramCumulative?: boolean;
+  /** value returned by the raw logs query in alerts: the number of matched logs (default) or 1 if any log matched */
+  alertValue?: 'count' | 'presence';
+  /** number of recent log lines attached to every series of the stats query in alerts as the `sample_lines` field */
+  alertSampleLines?: number;
+  /** maps log entries to annotation events for the annotations query type */
+  annotation?: AnnotationOptions;
+  /** the most frequent field values returned by the facets query type */
+  facets?: FacetsOptions;
+  /** time window (e.g. `5m`) or number of log lines (e.g. `100`) shown in the live mode before new log lines arrive */
+  tailBackfill?: string;
+  /** streams stats range and hits queries in dashboards: the query is executed on every step and only new or updated buckets are sent */
+  live?: boolean;
+  /** sliding window of stats range and hits queries in the live mode, the dashboard time range is used by default */
+  liveWindow?: string;
   /** Template builder state */
   templateBuilder?: TemplateQueryModel;
 }
 
+export interface AnnotationOptions {
+  titleField?: string;
+  textTemplate?: string;
+  tagFields?: string[];
+  streamTags?: boolean;
+  timeEndField?: string;
+  durationField?: string;
+}
+
+export interface FacetsOptions {
+  limit?: number;
+  maxValuesPerField?: number;
+  keepConstFields?: boolean;
+}
+
 export type VictoriaLogsQueryEditorProps = QueryEditorProps<VictoriaLogsDatasource, Query, Options>;
 
 export type DerivedFieldConfig = {
@@ -118,6 +175,8 @@ export type DerivedFieldConfig = {
   url?: string;
   urlDisplayLabel?: string;
   datasourceUid?: string;
+  /** type of the internal link datasource, it is used by the backend to build the query of the link */
+  datasourceType?: string;
   matcherType?: 'label' | 'regex';
 };
 
@@ -192,3 +251,11 @@ export type Tenant = {
   account_id: string;
   project_id: string;
 };
+
+export interface VictoriaLogsCapabilities {
+  version: string;
+  build: string;
+  tenantIds: boolean;
+  facets: boolean;
+  hitsOffset: boolean;
+}